@@ -13,3 +13,7 @@ func (me MultipleErrors) Error() string {
 
 	return fmt.Sprintf("error(s) occured (%d): \r\n%s", len(me), errStr)
 }
+
+func (me MultipleErrors) Unwrap() []error {
+	return me
+}
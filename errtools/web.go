@@ -1,5 +1,10 @@
 package errtools
 
+import (
+	"strconv"
+	"time"
+)
+
 type BodyNotAcceptedError string
 type BodyConsumedError string
 
@@ -10,3 +15,118 @@ func (e BodyNotAcceptedError) Error() string {
 func (e BodyConsumedError) Error() string {
 	return "body already consumed: " + string(e)
 }
+
+type RequestTimeoutError struct {
+	Url string
+	Err error
+}
+
+type RequestCanceledError struct {
+	Url string
+	Err error
+}
+
+func (e RequestTimeoutError) Error() string {
+	return "request timed out: " + e.Url
+}
+
+func (e RequestTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e RequestCanceledError) Error() string {
+	return "request canceled: " + e.Url
+}
+
+func (e RequestCanceledError) Unwrap() error {
+	return e.Err
+}
+
+type AuthorizationError string
+
+func (e AuthorizationError) Error() string {
+	return "authorization failed: " + string(e)
+}
+
+// HTTPStatusError is returned for responses with an unexpected status code, Body holds
+// the start of the response body
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Url        string
+	Headers    map[string][]string
+	Body       []byte
+}
+
+func (e HTTPStatusError) Error() string {
+	msg := "unexpected http status " + e.Status
+	if e.Url != "" {
+		msg += " from " + e.Url
+	}
+
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+
+	return msg
+}
+
+// APIError is an error decoded from the body of an error response, errors.As matches both
+// the decoded error and the HTTPStatusError of the response
+type APIError struct {
+	Err    error
+	Status HTTPStatusError
+}
+
+func (e APIError) Error() string {
+	return e.Err.Error() + " (" + e.Status.Status + ")"
+}
+
+func (e APIError) Unwrap() []error {
+	return []error{e.Err, e.Status}
+}
+
+type LimitExceededError string
+
+func (e LimitExceededError) Error() string {
+	return "limit exceeded: " + string(e)
+}
+
+type ChecksumMismatchError string
+
+func (e ChecksumMismatchError) Error() string {
+	return "checksum mismatch: " + string(e)
+}
+
+// Returned when a replayed cassette has no interaction matching a request
+type CassetteMismatchError string
+
+func (e CassetteMismatchError) Error() string {
+	return "no recorded interaction matches " + string(e)
+}
+
+// Returned without sending the request while the circuit breaker for the host is open
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e CircuitOpenError) Error() string {
+	return "circuit open for " + e.Host + " until " + e.Until.Format(time.RFC3339)
+}
+
+// Returned by a WebSocket after it was closed by either side, Code is the close code
+// sent in the close frame
+type WebSocketClosedError struct {
+	Code int
+	Text string
+}
+
+func (e WebSocketClosedError) Error() string {
+	msg := "websocket closed with code " + strconv.Itoa(e.Code)
+	if e.Text != "" {
+		msg += ": " + e.Text
+	}
+
+	return msg
+}
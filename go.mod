@@ -1,8 +1,10 @@
 module github.com/scheiblingco/gofn
 
-go 1.22.3
+go 1.23
 
 require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.17.11
 	golang.org/x/crypto v0.25.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,4 @@
+package webtools
+
+// Sign a request with a fixed client nonce to compare it with test vectors
+var DigestSignRequest = (*DigestAuth).signRequest
@@ -3,6 +3,7 @@ package webtools
 import (
 	"crypto/tls"
 	"net/http"
+	"net/http/cookiejar"
 )
 
 type ClientOpts interface {
@@ -18,6 +19,9 @@ func GetHttpClient(opts ...ClientOpts) *http.Client {
 	return client
 }
 
+// Present the certificate to servers that request one. It configures the client's
+// *http.Transport, or the transport wrapped by a Cassette, so the options can be given
+// in any order. Other transports are left unchanged
 type WithClientCertificate tls.Certificate
 
 func (wtc *WithClientCertificate) Apply(client *http.Client) {
@@ -25,9 +29,38 @@ func (wtc *WithClientCertificate) Apply(client *http.Client) {
 		client.Transport = &http.Transport{}
 	}
 
-	if client.Transport.(*http.Transport).TLSClientConfig == nil {
-		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{}
+	transport, ok := client.Transport.(*http.Transport)
+
+	if cassette, isCassette := client.Transport.(*Cassette); isCassette {
+		if cassette.Transport == nil {
+			cassette.Transport = &http.Transport{}
+		}
+
+		transport, ok = cassette.Transport.(*http.Transport)
+	}
+
+	if !ok {
+		return
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	transport.TLSClientConfig.Certificates = []tls.Certificate{tls.Certificate(*wtc)}
+}
+
+// Store cookies received by the client in the jar and send them with following requests,
+// a new in-memory jar is used when Jar is nil. Use a CookieSession to persist the cookies
+type WithCookieJar struct {
+	Jar http.CookieJar
+}
+
+func (wcj *WithCookieJar) Apply(client *http.Client) {
+	if wcj.Jar == nil {
+		client.Jar, _ = cookiejar.New(nil)
+		return
 	}
 
-	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{tls.Certificate(*wtc)}
+	client.Jar = wcj.Jar
 }
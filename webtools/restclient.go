@@ -2,13 +2,20 @@ package webtools
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"io"
+	"maps"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/scheiblingco/gofn/errtools"
 	"github.com/scheiblingco/gofn/typetools"
@@ -17,22 +24,46 @@ import (
 type RequestMethod string
 
 const (
-	GET    RequestMethod = "GET"
-	POST   RequestMethod = "POST"
-	PUT    RequestMethod = "PUT"
-	DELETE RequestMethod = "DELETE"
-	PATCH  RequestMethod = "PATCH"
+	GET     RequestMethod = "GET"
+	POST    RequestMethod = "POST"
+	PUT     RequestMethod = "PUT"
+	DELETE  RequestMethod = "DELETE"
+	PATCH   RequestMethod = "PATCH"
+	HEAD    RequestMethod = "HEAD"
+	OPTIONS RequestMethod = "OPTIONS"
 )
 
 type RestRequest struct {
 	Url    string
 	Method RequestMethod
 
+	// Header holds all request headers. Headers is a single valued view of Header kept
+	// for compatibility, values written directly to the map replace those in Header when
+	// the request is sent
+	Header  http.Header
 	Headers map[string]string
 
 	BodyReader io.Reader
 
-	errs []error
+	body        []byte
+	bodyReader  io.Reader
+	compression CompressionAlgorithm
+
+	auth    Authorization
+	client  *RestClient
+	ctx     context.Context
+	timeout time.Duration
+	retrier Retrier
+	errs    []error
+
+	middleware []Middleware
+
+	// Query parameters set by the authorization, they are only added to the sent url
+	authQuery url.Values
+
+	// Canonical keys of Header that are mirrored in Headers, removing one of them from
+	// the map removes the header
+	mirrored map[string]bool
 }
 
 type RestResponse struct {
@@ -40,6 +71,9 @@ type RestResponse struct {
 	Headers    map[string][]string
 	Response   *http.Response
 
+	// Set when the request went through a Cache
+	CacheStatus CacheStatus
+
 	bodyRead bool
 }
 
@@ -47,22 +81,132 @@ func (r *RestRequest) addError(err error) {
 	r.errs = append(r.errs, err)
 }
 
+// The authorization is applied each time the request is sent, so credentials
+// that expire or depend on the final request are always current. Headers it sets
+// are not visible in Header or Headers before the request is executed
 func (r *RestRequest) WithAuthorization(auth Authorization) *RestRequest {
-	return auth.Apply(r)
+	if auth == nil {
+		r.addError(errtools.MissingValueError("authorization"))
+		return r
+	}
+
+	r.auth = auth
+
+	return r
+}
+
+func (r *RestRequest) WithContext(ctx context.Context) *RestRequest {
+	if ctx == nil {
+		r.addError(errtools.MissingValueError("context"))
+		return r
+	}
+
+	r.ctx = ctx
+
+	return r
+}
+
+func (r *RestRequest) WithTimeout(timeout time.Duration) *RestRequest {
+	r.timeout = timeout
+	return r
+}
+
+func (r *RestRequest) WithRetry(retrier Retrier) *RestRequest {
+	r.retrier = retrier
+	return r
 }
 
+// Set the header, replacing any existing values
 func (r *RestRequest) WithHeader(key, value string) *RestRequest {
 	if key == "" {
 		r.addError(errtools.InvalidKeyError("header key cannot be empty"))
+		return r
+	}
+
+	r.initHeaders()
+	r.deleteHeadersKey(key)
+
+	r.Header.Set(key, value)
+	r.Headers[http.CanonicalHeaderKey(key)] = value
+	r.mirrored[http.CanonicalHeaderKey(key)] = true
+
+	return r
+}
+
+// Add a value to the header, keeping existing values
+func (r *RestRequest) AddHeader(key, value string) *RestRequest {
+	if key == "" {
+		r.addError(errtools.InvalidKeyError("header key cannot be empty"))
+		return r
+	}
+
+	r.initHeaders()
+	r.deleteHeadersKey(key)
+
+	r.Header.Add(key, value)
+	r.Headers[http.CanonicalHeaderKey(key)] = r.Header.Get(key)
+	r.mirrored[http.CanonicalHeaderKey(key)] = true
+
+	return r
+}
+
+func (r *RestRequest) DelHeader(key string) *RestRequest {
+	r.initHeaders()
+	r.deleteHeadersKey(key)
+	r.Header.Del(key)
+	delete(r.mirrored, http.CanonicalHeaderKey(key))
+
+	return r
+}
+
+func (r *RestRequest) initHeaders() {
+	if r.Header == nil {
+		r.Header = http.Header{}
 	}
 
 	if r.Headers == nil {
 		r.Headers = make(map[string]string)
 	}
 
-	r.Headers[key] = value
+	if r.mirrored == nil {
+		r.mirrored = make(map[string]bool)
+	}
+}
 
-	return r
+// Remove a key from the map in any casing
+func (r *RestRequest) deleteHeadersKey(key string) {
+	for k := range r.Headers {
+		if strings.EqualFold(k, key) {
+			delete(r.Headers, k)
+		}
+	}
+}
+
+// The headers that are sent, Header merged with values written directly to Headers.
+// Mirrored headers that were deleted from Headers are not sent
+func (r *RestRequest) effectiveHeader() http.Header {
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	inMap := make(map[string]bool, len(r.Headers))
+
+	for k, v := range r.Headers {
+		inMap[http.CanonicalHeaderKey(k)] = true
+
+		if header.Get(k) != v {
+			header.Set(k, v)
+		}
+	}
+
+	for k := range r.mirrored {
+		if !inMap[k] {
+			header.Del(k)
+		}
+	}
+
+	return header
 }
 
 func (r *RestRequest) WithHeaders(headers map[string]string) *RestRequest {
@@ -78,7 +222,7 @@ func (r *RestRequest) WithBodyBytes(body []byte) *RestRequest {
 		r.addError(errtools.BodyNotAcceptedError(strings.ToLower(string(r.Method)) + " requests do not accept a body"))
 	}
 
-	r.BodyReader = bytes.NewReader(body)
+	r.setBody(body)
 
 	return r
 }
@@ -152,10 +296,6 @@ func (r *RestRequest) WithMultipartFormBody(body []MultipartField) *RestRequest
 		r.addError(errtools.BodyNotAcceptedError(strings.ToLower(string(r.Method)) + " requests do not accept a body"))
 	}
 
-	if r.Headers == nil {
-		r.Headers = make(map[string]string)
-	}
-
 	buf := &bytes.Buffer{}
 	writer := multipart.NewWriter(buf)
 
@@ -174,18 +314,49 @@ func (r *RestRequest) WithMultipartFormBody(body []MultipartField) *RestRequest
 		return r
 	}
 
-	r.BodyReader = buf
+	r.setBody(buf.Bytes())
 
 	return r.WithHeader("Content-Type", writer.FormDataContentType())
 }
 
-func (r *RestRequest) WithUrlencodedFormBody(body interface{}, contentType *string) *RestRequest {
+// Stream the multipart body while the request is sent instead of buffering it in memory.
+// progress is called as the fields are written and may be nil, streamed bodies are not retried
+func (r *RestRequest) WithStreamingMultipartFormBody(body []MultipartField, progress MultipartProgress) *RestRequest {
 	if r.Method == GET || r.Method == DELETE {
 		r.addError(errtools.BodyNotAcceptedError(strings.ToLower(string(r.Method)) + " requests do not accept a body"))
 	}
 
-	if r.Headers == nil {
-		r.Headers = make(map[string]string)
+	for _, field := range body {
+		if field.value == nil && field.path == nil {
+			r.addError(errtools.MissingValueError("multipart field " + field.Key))
+		}
+
+		if field.path != nil {
+			if _, err := os.Stat(*field.path); err != nil {
+				r.addError(err)
+			}
+		}
+	}
+
+	if r.compression != "" {
+		r.addError(errtools.BodyNotAcceptedError("a streamed body cannot be compressed"))
+	}
+
+	if len(r.errs) > 0 {
+		return r
+	}
+
+	stream := newMultipartStream(body, progress)
+
+	r.body = nil
+	r.BodyReader = stream
+
+	return r.WithHeader("Content-Type", stream.mpWriter.FormDataContentType())
+}
+
+func (r *RestRequest) WithUrlencodedFormBody(body interface{}, contentType *string) *RestRequest {
+	if r.Method == GET || r.Method == DELETE {
+		r.addError(errtools.BodyNotAcceptedError(strings.ToLower(string(r.Method)) + " requests do not accept a body"))
 	}
 
 	cType := "application/x-www-form-urlencoded"
@@ -235,22 +406,53 @@ func (r *RestRequest) WithUrlencodedFormBody(body interface{}, contentType *stri
 }
 
 func (r *RestRequest) WithQueryParams(params map[string]string) *RestRequest {
-	if len(params) == 0 {
-		return r
+	values := url.Values{}
+
+	for k, v := range params {
+		values.Add(k, v)
 	}
 
-	if strings.Contains(r.Url, "?") {
-		r.Url += "&"
-	} else {
-		r.Url += "?"
+	return r.WithQueryValues(values)
+}
+
+// Replace all values of the query parameter in the url
+func (r *RestRequest) setQueryParam(key, value string) error {
+	parsed, err := url.Parse(r.Url)
+	if err != nil {
+		return err
 	}
 
-	for k, v := range params {
-		r.Url += k + "=" + v + "&"
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	r.Url = parsed.String()
+
+	return nil
+}
+
+// Clone returns a copy of the request that can be modified and executed independently,
+// a body set from a reader is shared with the original
+func (r *RestRequest) Clone() *RestRequest {
+	clone := *r
+
+	clone.Header = r.Header.Clone()
+
+	if r.Headers != nil {
+		clone.Headers = make(map[string]string, len(r.Headers))
+		for k, v := range r.Headers {
+			clone.Headers[k] = v
+		}
 	}
 
-	r.Url = strings.TrimRight(r.Url, "&")
+	clone.mirrored = maps.Clone(r.mirrored)
+	clone.errs = slices.Clone(r.errs)
+	clone.middleware = slices.Clone(r.middleware)
 
+	return &clone
+}
+
+func (r *RestRequest) withMethod(method RequestMethod) *RestRequest {
+	r.Method = method
 	return r
 }
 
@@ -267,74 +469,274 @@ func (r *RestRequest) Validate() error {
 		return errtools.MissingValueError("method")
 	}
 
+	if missing := unresolvedPathParams(r.Url); len(missing) > 0 {
+		errs := errtools.MultipleErrors{}
+		for _, name := range missing {
+			errs = append(errs, errtools.MissingValueError("path parameter "+name))
+		}
+
+		return errs
+	}
+
 	return nil
 }
 
 func (r *RestRequest) Execute() (*RestResponse, error) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return r.ExecuteContext(ctx)
+}
+
+// Execute the request, bound to the context and the timeout set with WithTimeout.
+// The context stays alive until the response body has been closed
+func (r *RestRequest) ExecuteContext(ctx context.Context) (*RestResponse, error) {
 	if err := r.Validate(); err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(string(r.Method), r.Url, r.BodyReader)
+	cancel := context.CancelFunc(func() {})
+	if r.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := r.send(ctx)
+
+		if r.retrier == nil || !r.replayable() || ctx.Err() != nil {
+			return r.finish(resp, err, cancel)
+		}
+
+		delay, retry := r.retrier.ShouldRetry(attempt, r, resp, err)
+		if !retry {
+			return r.finish(resp, err, cancel)
+		}
+
+		if resp != nil {
+			resp.discard()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			cancel()
+			return nil, r.wrapError(ctx, ctx.Err())
+		}
+	}
+}
+
+// Send the request, answering a single authorization challenge if the
+// authorization supports it
+func (r *RestRequest) send(ctx context.Context) (*RestResponse, error) {
+	resp, err := r.sendOnce(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	if r.Headers != nil && len(r.Headers) > 0 {
-		for k, v := range r.Headers {
-			req.Header.Add(k, v)
-		}
+	challenger, ok := r.auth.(ChallengeAuthorization)
+	if !ok || resp.StatusCode != http.StatusUnauthorized || !r.replayable() {
+		return resp, nil
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	retry, err := challenger.Challenge(r, resp)
 	if err != nil {
+		resp.discard()
 		return nil, err
 	}
-	return &RestResponse{
-		Response:   resp,
-		StatusCode: resp.StatusCode,
-		Headers:    resp.Header,
-	}, nil
+
+	if !retry {
+		return resp, nil
+	}
+
+	resp.discard()
+
+	return r.sendOnce(ctx)
+}
+
+func (r *RestRequest) sendOnce(ctx context.Context) (*RestResponse, error) {
+	if err := r.applyAuth(ctx); err != nil {
+		return nil, r.wrapError(ctx, err)
+	}
+
+	body := r.BodyReader
+	if r.replayable() && r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	if len(r.authQuery) > 0 {
+		ctx = context.WithValue(ctx, redactedQueryKey{}, slices.Collect(maps.Keys(r.authQuery)))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, string(r.Method), r.Url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.addAuthQuery(req.URL)
+
+	req.Header = r.effectiveHeader()
+
+	resp, err := r.doer().Do(req)
+	if err != nil {
+		return nil, r.wrapError(ctx, err)
+	}
+
+	if resp == nil || resp.Response == nil {
+		return nil, errtools.MissingValueError("response")
+	}
+
+	return resp, nil
+}
+
+func (r *RestRequest) addAuthQuery(u *url.URL) {
+	if len(r.authQuery) == 0 {
+		return
+	}
+
+	query := u.Query()
+	for k, values := range r.authQuery {
+		query[k] = values
+	}
+
+	u.RawQuery = query.Encode()
+}
+
+// Apply the authorization with ctx as the request context, so credentials
+// fetched over the network are bound to the execution and its timeout
+func (r *RestRequest) applyAuth(ctx context.Context) error {
+	if r.auth == nil {
+		return nil
+	}
+
+	saved := r.ctx
+	r.ctx = ctx
+	r.authQuery = nil
+	defer func() { r.ctx = saved }()
+
+	known := len(r.errs)
+
+	if applied := r.auth.Apply(r); applied != nil && applied != r {
+		*r = *applied
+	}
+
+	if len(r.errs) > known {
+		errs := errtools.MultipleErrors(r.errs[known:])
+		r.errs = r.errs[:known]
+		return errs
+	}
+
+	return nil
+}
+
+func (r *RestRequest) finish(resp *RestResponse, err error, cancel context.CancelFunc) (*RestResponse, error) {
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Response.Body = &cancelOnClose{ReadCloser: resp.Response.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+func (r *RestRequest) setBody(body []byte) {
+	if r.compression != "" {
+		compressed, err := compressBody(r.compression, body)
+		if err != nil {
+			r.addError(err)
+			return
+		}
+
+		body = compressed
+		r.WithHeader("Content-Encoding", string(r.compression))
+	}
+
+	r.body = body
+	r.BodyReader = bytes.NewReader(body)
+	r.bodyReader = r.BodyReader
+}
+
+// A request can be sent more than once if it has no body or the body was set
+// from bytes and BodyReader has not been replaced since
+func (r *RestRequest) replayable() bool {
+	return r.BodyReader == nil || (r.body != nil && r.BodyReader == r.bodyReader)
 }
 
+func (r *RestRequest) wrapError(ctx context.Context, err error) error {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return errtools.RequestTimeoutError{Url: r.Url, Err: err}
+	case errors.Is(err, context.Canceled), errors.Is(ctx.Err(), context.Canceled):
+		return errtools.RequestCanceledError{Url: r.Url, Err: err}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return errtools.RequestTimeoutError{Url: r.Url, Err: err}
+	}
+
+	return err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// The body readers decompress gzip, deflate and zstd bodies according to the Content-Encoding header
 func (r *RestResponse) BodyAsBytes() ([]byte, error) {
 	if r.bodyRead {
 		return nil, errtools.BodyConsumedError("body has already been read")
 	}
 	r.bodyRead = true
-	defer r.Response.Body.Close()
-	return io.ReadAll(r.Response.Body)
+	return r.readBody(-1)
 }
 
 func (r *RestResponse) BodyAsString() (string, error) {
 	b, err := r.BodyAsBytes()
-	if r.bodyRead {
-		return "", errtools.BodyConsumedError("body has already been read")
-	}
-	r.bodyRead = true
 	return string(b), err
 }
 
 func (r *RestResponse) UnmarshalJsonBody(v interface{}) error {
-	if r.bodyRead {
-		return errtools.BodyConsumedError("body has already been read")
+	b, err := r.BodyAsBytes()
+	if err != nil {
+		return err
 	}
-	r.bodyRead = true
-	return json.NewDecoder(r.Response.Body).Decode(v)
+	return json.NewDecoder(bytes.NewReader(b)).Decode(v)
 }
 
 func (r *RestResponse) UnmarshalXmlBody(v interface{}) error {
-	if r.bodyRead {
-		return errtools.BodyConsumedError("body has already been read")
+	b, err := r.BodyAsBytes()
+	if err != nil {
+		return err
 	}
-	r.bodyRead = true
-	return xml.NewDecoder(r.Response.Body).Decode(v)
+	return xml.NewDecoder(bytes.NewReader(b)).Decode(v)
 }
 
 func (r *RestResponse) Close() {
 	r.Response.Body.Close()
 }
 
+// Drain a limited amount of the body before closing so the connection can be reused
+func (r *RestResponse) discard() {
+	io.Copy(io.Discard, io.LimitReader(r.Response.Body, 64<<10))
+	r.Response.Body.Close()
+}
+
+func NewRestResponse(resp *http.Response) *RestResponse {
+	return &RestResponse{
+		Response:   resp,
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+	}
+}
+
 func NewRequest(method RequestMethod, url string) *RestRequest {
 	return &RestRequest{
 		Method: method,
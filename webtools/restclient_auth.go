@@ -2,23 +2,166 @@ package webtools
 
 import (
 	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/scheiblingco/gofn/errtools"
 )
 
+// Authorization adds credentials to a request. Apply is called each time the request is sent,
+// with the context it is executed with, and may change the request in place or return a modified
+// copy. Errors are reported with the request's error list and fail the execution
 type Authorization interface {
 	Apply(*RestRequest) *RestRequest
 }
 
+// ChallengeAuthorization is an Authorization that can respond to a 401 response,
+// returning true from Challenge sends the request again with the authorization re-applied
+type ChallengeAuthorization interface {
+	Authorization
+	Challenge(*RestRequest, *RestResponse) (bool, error)
+}
+
 type BasicAuth struct {
 	Username string
 	Password string
 }
 
 func (ba *BasicAuth) Apply(req *RestRequest) *RestRequest {
-	if req.Headers == nil {
-		req.Headers = make(map[string]string)
+	return req.WithHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(ba.Username+":"+ba.Password)))
+}
+
+// BearerToken sends a static token, or the token returned by TokenSource when set
+type BearerToken struct {
+	Token       string
+	TokenSource func() (string, error)
+}
+
+func (bt *BearerToken) Apply(req *RestRequest) *RestRequest {
+	token := bt.Token
+
+	if bt.TokenSource != nil {
+		var err error
+		if token, err = bt.TokenSource(); err != nil {
+			req.addError(err)
+			return req
+		}
+	}
+
+	if token == "" {
+		req.addError(errtools.MissingValueError("bearer token"))
+		return req
 	}
 
-	req.Headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(ba.Username+":"+ba.Password))
+	return req.WithHeader("Authorization", "Bearer "+token)
+}
+
+type APIKeyPlacement string
+
+const (
+	APIKeyInHeader APIKeyPlacement = "header"
+	APIKeyInQuery  APIKeyPlacement = "query"
+	APIKeyInCookie APIKeyPlacement = "cookie"
+)
+
+// APIKey sends a key as a header, query parameter or cookie with the given name,
+// the placement defaults to a header
+type APIKey struct {
+	Name      string
+	Value     string
+	Placement APIKeyPlacement
+}
+
+func (ak *APIKey) Apply(req *RestRequest) *RestRequest {
+	if ak.Name == "" {
+		req.addError(errtools.MissingValueError("api key name"))
+		return req
+	}
+
+	switch ak.Placement {
+	case APIKeyInHeader, "":
+		return req.WithHeader(ak.Name, ak.Value)
+
+	case APIKeyInQuery:
+		if req.authQuery == nil {
+			req.authQuery = url.Values{}
+		}
+
+		req.authQuery.Set(ak.Name, ak.Value)
+
+		return req
+
+	case APIKeyInCookie:
+		cookies := []string{}
+
+		for _, cookie := range strings.Split(strings.Join(req.effectiveHeader().Values("Cookie"), ";"), ";") {
+			cookie = strings.TrimSpace(cookie)
+			if cookie != "" && !strings.HasPrefix(cookie, ak.Name+"=") {
+				cookies = append(cookies, cookie)
+			}
+		}
+
+		return req.WithHeader("Cookie", strings.Join(append(cookies, ak.Name+"="+ak.Value), "; "))
+	}
+
+	req.addError(errtools.InvalidTypeError("api key placement must be header, query or cookie"))
+
+	return req
+}
+
+type redactedQueryKey struct{}
+
+// The url of a sent request with the values of query parameters set by the authorization
+// replaced, for use in errors and recordings
+func redactedUrl(req *http.Request) *url.URL {
+	names, _ := req.Context().Value(redactedQueryKey{}).([]string)
+	if len(names) == 0 {
+		return req.URL
+	}
+
+	redacted := *req.URL
+	query := redacted.Query()
+
+	for _, name := range names {
+		if query.Has(name) {
+			query.Set(name, CassetteRedacted)
+		}
+	}
+
+	redacted.RawQuery = query.Encode()
+
+	return &redacted
+}
+
+// ChainAuth applies several authorizations in order, challenges are passed to every
+// member that supports them
+type ChainAuth []Authorization
+
+func (ca ChainAuth) Apply(req *RestRequest) *RestRequest {
+	for _, auth := range ca {
+		req = auth.Apply(req)
+	}
 
 	return req
 }
+
+func (ca ChainAuth) Challenge(req *RestRequest, resp *RestResponse) (bool, error) {
+	retry := false
+
+	for _, auth := range ca {
+		challenger, ok := auth.(ChallengeAuthorization)
+		if !ok {
+			continue
+		}
+
+		ok, err := challenger.Challenge(req, resp)
+		if err != nil {
+			return false, err
+		}
+
+		retry = retry || ok
+	}
+
+	return retry, nil
+}
@@ -0,0 +1,260 @@
+package webtools
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// DigestAuth implements RFC 7616 digest authentication. The first request is sent without
+// credentials, the challenge from the 401 response is answered and its nonce is reused
+// for following requests until the server rejects it
+type DigestAuth struct {
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        uint32
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	hash      func() hash.Hash
+	session   bool
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"SHA-256": sha256.New,
+	"MD5":     md5.New,
+}
+
+func (da *DigestAuth) Apply(req *RestRequest) *RestRequest {
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	if da.challenge == nil {
+		return req
+	}
+
+	uri, err := digestUri(req.Url)
+	if err != nil {
+		req.addError(err)
+		return req
+	}
+
+	da.nc++
+
+	return req.WithHeader("Authorization", da.challenge.authorization(da.Username, da.Password, string(req.Method), uri, da.nc, newCnonce()))
+}
+
+// Set the Authorization header of req in answer to the last challenge with the given client
+// nonce, the nonce count is shared with requests sent through Apply
+func (da *DigestAuth) signRequest(req *http.Request, cnonce string) error {
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	if da.challenge == nil {
+		return errtools.AuthorizationError("no digest challenge has been received")
+	}
+
+	da.nc++
+
+	req.Header.Set("Authorization", da.challenge.authorization(da.Username, da.Password, req.Method, req.URL.RequestURI(), da.nc, cnonce))
+
+	return nil
+}
+
+func (da *DigestAuth) Challenge(req *RestRequest, resp *RestResponse) (bool, error) {
+	var challenge *digestChallenge
+
+	for _, header := range http.Header(resp.Headers).Values("WWW-Authenticate") {
+		parsed, ok := parseDigestChallenge(header)
+		if !ok {
+			continue
+		}
+
+		// Prefer SHA-256 when the server offers several algorithms
+		if challenge == nil || strings.HasPrefix(parsed.algorithm, "SHA-256") {
+			challenge = parsed
+		}
+	}
+
+	if challenge == nil {
+		return false, errtools.AuthorizationError("server did not send a supported digest challenge")
+	}
+
+	da.mu.Lock()
+	defer da.mu.Unlock()
+
+	da.challenge = challenge
+	da.nc = 0
+
+	return true, nil
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, bool) {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	values := parseAuthParams(params)
+
+	challenge := &digestChallenge{
+		realm:     values["realm"],
+		nonce:     values["nonce"],
+		opaque:    values["opaque"],
+		algorithm: values["algorithm"],
+	}
+
+	if challenge.nonce == "" {
+		return nil, false
+	}
+
+	if challenge.algorithm == "" {
+		challenge.algorithm = "MD5"
+	}
+
+	base, session := strings.CutSuffix(strings.ToUpper(challenge.algorithm), "-SESS")
+	if challenge.hash = digestAlgorithms[base]; challenge.hash == nil {
+		return nil, false
+	}
+	challenge.session = session
+
+	if qop, ok := values["qop"]; ok {
+		for _, option := range strings.Split(qop, ",") {
+			if strings.TrimSpace(option) == "auth" {
+				challenge.qop = "auth"
+			}
+		}
+
+		// Only auth is supported, auth-int would require hashing the body
+		if challenge.qop == "" {
+			return nil, false
+		}
+	}
+
+	return challenge, true
+}
+
+func (dc *digestChallenge) authorization(username, password, method, uri string, nc uint32, cnonce string) string {
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	ha1 := dc.digest(username + ":" + dc.realm + ":" + password)
+	if dc.session {
+		ha1 = dc.digest(ha1 + ":" + dc.nonce + ":" + cnonce)
+	}
+
+	ha2 := dc.digest(method + ":" + uri)
+
+	var response string
+	if dc.qop == "" {
+		response = dc.digest(ha1 + ":" + dc.nonce + ":" + ha2)
+	} else {
+		response = dc.digest(ha1 + ":" + dc.nonce + ":" + ncValue + ":" + cnonce + ":" + dc.qop + ":" + ha2)
+	}
+
+	params := []string{
+		fmt.Sprintf(`username="%s"`, quoteEscaper.Replace(username)),
+		fmt.Sprintf(`realm="%s"`, quoteEscaper.Replace(dc.realm)),
+		fmt.Sprintf(`nonce="%s"`, quoteEscaper.Replace(dc.nonce)),
+		fmt.Sprintf(`uri="%s"`, quoteEscaper.Replace(uri)),
+		"algorithm=" + dc.algorithm,
+		fmt.Sprintf(`response="%s"`, response),
+	}
+
+	if dc.qop != "" {
+		params = append(params, "qop="+dc.qop, "nc="+ncValue, fmt.Sprintf(`cnonce="%s"`, quoteEscaper.Replace(cnonce)))
+	}
+
+	if dc.opaque != "" {
+		params = append(params, fmt.Sprintf(`opaque="%s"`, quoteEscaper.Replace(dc.opaque)))
+	}
+
+	return "Digest " + strings.Join(params, ", ")
+}
+
+func (dc *digestChallenge) digest(value string) string {
+	h := dc.hash()
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Parse comma separated key=value pairs where values may be quoted
+func parseAuthParams(params string) map[string]string {
+	values := map[string]string{}
+
+	for len(params) > 0 {
+		params = strings.TrimLeft(params, " ,")
+
+		key, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			break
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " ")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest = parseQuoted(rest[1:])
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+
+		values[key] = value
+		params = rest
+	}
+
+	return values
+}
+
+func parseQuoted(s string) (string, string) {
+	value := strings.Builder{}
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+
+	return value.String(), ""
+}
+
+func digestUri(rawUrl string) (string, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	return parsed.RequestURI(), nil
+}
+
+func newCnonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,137 @@
+package webtools_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+const (
+	digestRealm  = "http-auth@example.org"
+	digestNonce  = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+	digestOpaque = "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"
+)
+
+var digestParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDigestAuth(t *testing.T) {
+	challenges := 0
+	lastNc := ""
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		for _, match := range digestParam.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+			params[match[1]] = match[2] + match[3]
+		}
+
+		if params["nonce"] != digestNonce || params["opaque"] != digestOpaque || params["algorithm"] != "SHA-256" {
+			challenges++
+			w.Header().Add("WWW-Authenticate", `Digest realm="`+digestRealm+`", qop="auth, auth-int", algorithm=MD5, nonce="`+digestNonce+`", opaque="`+digestOpaque+`"`)
+			w.Header().Add("WWW-Authenticate", `Digest realm="`+digestRealm+`", qop="auth, auth-int", algorithm=SHA-256, nonce="`+digestNonce+`", opaque="`+digestOpaque+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ha1 := sha256Hex("Mufasa:" + digestRealm + ":Circle of Life")
+		ha2 := sha256Hex(r.Method + ":" + r.URL.RequestURI())
+		expected := sha256Hex(ha1 + ":" + digestNonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+
+		if params["uri"] != r.URL.RequestURI() || params["response"] != expected || params["nc"] <= lastNc {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		lastNc = params["nc"]
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := webtools.NewRestClient(srv.URL).WithAuthorization(&webtools.DigestAuth{Username: "Mufasa", Password: "Circle of Life"})
+
+	for _, path := range []string{"/dir/index.html", "/dir/other.html?key=value"} {
+		resp, err := client.Get(path).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status code 200 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+
+	if challenges != 1 {
+		t.Errorf("Expected the nonce to be reused after a single challenge, got %d challenges", challenges)
+	}
+}
+
+// Test vectors from RFC 7616 section 3.9.1 and a regression case for escaped values
+func TestDigestAuthVectors(t *testing.T) {
+	const cnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+
+	tests := []struct {
+		algorithm     string
+		username      string
+		realm         string
+		authorization string
+	}{
+		{
+			algorithm:     "MD5",
+			username:      "Mufasa",
+			realm:         `"` + digestRealm + `"`,
+			authorization: `Digest username="Mufasa", realm="http-auth@example.org", nonce="` + digestNonce + `", uri="/dir/index.html", algorithm=MD5, response="8ca523f5e9506fed4657c9700eebdbec", qop=auth, nc=00000001, cnonce="` + cnonce + `", opaque="` + digestOpaque + `"`,
+		},
+		{
+			algorithm:     "SHA-256",
+			username:      "Mufasa",
+			realm:         `"` + digestRealm + `"`,
+			authorization: `Digest username="Mufasa", realm="http-auth@example.org", nonce="` + digestNonce + `", uri="/dir/index.html", algorithm=SHA-256, response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1", qop=auth, nc=00000001, cnonce="` + cnonce + `", opaque="` + digestOpaque + `"`,
+		},
+		{
+			// Not from the RFC. Quotes and backslashes in quoted values are escaped, the response was
+			// computed separately as the MD5 digest of the RFC inputs with the unescaped username and realm
+			algorithm:     "MD5",
+			username:      `Mu"fa\sa`,
+			realm:         `"http-auth@\"example\".org"`,
+			authorization: `Digest username="Mu\"fa\\sa", realm="http-auth@\"example\".org", nonce="` + digestNonce + `", uri="/dir/index.html", algorithm=MD5, response="26e42c43f462f5057a36a29a4862bf75", qop=auth, nc=00000001, cnonce="` + cnonce + `", opaque="` + digestOpaque + `"`,
+		},
+	}
+
+	for _, test := range tests {
+		auth := &webtools.DigestAuth{Username: test.username, Password: "Circle of Life"}
+
+		challenge := webtools.NewRestResponse(&http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Header: http.Header{
+				"Www-Authenticate": {`Digest realm=` + test.realm + `, qop="auth", algorithm=` + test.algorithm + `, nonce="` + digestNonce + `", opaque="` + digestOpaque + `"`},
+			},
+		})
+
+		if _, err := auth.Challenge(nil, challenge); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "http://www.example.org/dir/index.html", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := webtools.DigestSignRequest(auth, req, cnonce); err != nil {
+			t.Fatal(err)
+		}
+
+		if req.Header.Get("Authorization") != test.authorization {
+			t.Errorf("%s %s: expected authorization\n%s\ngot\n%s", test.algorithm, test.username, test.authorization, req.Header.Get("Authorization"))
+		}
+	}
+}
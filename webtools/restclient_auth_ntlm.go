@@ -0,0 +1,262 @@
+package webtools
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmNegotiateOEM             = 0x00000002
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSession
+
+	ntlmAvEOL       = 0
+	ntlmAvTimestamp = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// NTLMAuth performs the NTLMv2 handshake: the request is sent with a negotiate message,
+// the challenge from the 401 response is answered with an authenticate message on the same
+// kept-alive connection. The user may be given as DOMAIN\user when Domain is empty
+type NTLMAuth struct {
+	Domain      string
+	User        string
+	Password    string
+	Workstation string
+
+	// Use the Negotiate scheme instead of NTLM for servers that only offer Negotiate
+	UseNegotiate bool
+
+	mu         sync.Mutex
+	challenges map[*RestRequest][]byte
+}
+
+func (na *NTLMAuth) Apply(req *RestRequest) *RestRequest {
+	na.mu.Lock()
+	challenge, ok := na.challenges[req]
+	delete(na.challenges, req)
+	na.mu.Unlock()
+
+	if !ok {
+		return req.WithHeader("Authorization", na.scheme()+" "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	}
+
+	authenticate, err := na.authenticateMessage(challenge)
+	if err != nil {
+		req.addError(err)
+		return req
+	}
+
+	return req.WithHeader("Authorization", na.scheme()+" "+base64.StdEncoding.EncodeToString(authenticate))
+}
+
+func (na *NTLMAuth) Challenge(req *RestRequest, resp *RestResponse) (bool, error) {
+	for _, header := range http.Header(resp.Headers).Values("WWW-Authenticate") {
+		scheme, token, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, na.scheme()) || token == "" {
+			continue
+		}
+
+		challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(token))
+		if err != nil {
+			return false, errtools.AuthorizationError("invalid ntlm challenge encoding")
+		}
+
+		na.mu.Lock()
+		defer na.mu.Unlock()
+
+		if na.challenges == nil {
+			na.challenges = make(map[*RestRequest][]byte)
+		}
+
+		na.challenges[req] = challenge
+
+		return true, nil
+	}
+
+	// The server rejected the authenticate message or does not support ntlm
+	return false, nil
+}
+
+func (na *NTLMAuth) scheme() string {
+	if na.UseNegotiate {
+		return "Negotiate"
+	}
+
+	return "NTLM"
+}
+
+func (na *NTLMAuth) credentials() (string, string) {
+	if na.Domain == "" {
+		if domain, user, ok := strings.Cut(na.User, `\`); ok {
+			return domain, user
+		}
+	}
+
+	return na.Domain, na.User
+}
+
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+
+	return msg
+}
+
+func (na *NTLMAuth) authenticateMessage(challenge []byte) ([]byte, error) {
+	if len(challenge) < 48 || !bytes.Equal(challenge[:8], ntlmSignature) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, errtools.AuthorizationError("invalid ntlm challenge message")
+	}
+
+	flags := binary.LittleEndian.Uint32(challenge[20:])
+	serverChallenge := challenge[24:32]
+
+	targetInfo, ok := ntlmSecurityBuffer(challenge, 40)
+	if !ok {
+		return nil, errtools.AuthorizationError("invalid ntlm target info")
+	}
+
+	domain, user := na.credentials()
+
+	clientChallenge := make([]byte, 8)
+	rand.Read(clientChallenge)
+
+	timestamp := ntlmTimestamp(targetInfo)
+	if timestamp == nil {
+		timestamp = make([]byte, 8)
+		binary.LittleEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()/100+116444736000000000))
+	}
+
+	responseKey := ntlmV2Hash(domain, user, na.Password)
+
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	ntProof := hmacMd5(responseKey, serverChallenge, temp)
+	ntResponse := append(ntProof, temp...)
+	lmResponse := append(hmacMd5(responseKey, serverChallenge, clientChallenge), clientChallenge...)
+
+	encode := ntlmOEM
+	negotiated := uint32(ntlmNegotiateFlags &^ ntlmNegotiateUnicode &^ ntlmNegotiateOEM)
+	if flags&ntlmNegotiateUnicode != 0 {
+		encode = ntlmUnicode
+		negotiated |= ntlmNegotiateUnicode
+	} else {
+		negotiated |= ntlmNegotiateOEM
+	}
+
+	payloads := [][]byte{lmResponse, ntResponse, encode(domain), encode(user), encode(na.Workstation), {}}
+
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+
+	offset := len(msg)
+	for i, payload := range payloads {
+		field := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[field:], uint16(len(payload)))
+		binary.LittleEndian.PutUint16(msg[field+2:], uint16(len(payload)))
+		binary.LittleEndian.PutUint32(msg[field+4:], uint32(offset))
+		offset += len(payload)
+	}
+
+	binary.LittleEndian.PutUint32(msg[60:], negotiated)
+
+	for _, payload := range payloads {
+		msg = append(msg, payload...)
+	}
+
+	return msg, nil
+}
+
+// Read the security buffer (length, allocated, offset) at the given position of a message
+func ntlmSecurityBuffer(msg []byte, pos int) ([]byte, bool) {
+	length := int(binary.LittleEndian.Uint16(msg[pos:]))
+	offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+
+	if length == 0 {
+		return []byte{}, true
+	}
+
+	if offset+length > len(msg) {
+		return nil, false
+	}
+
+	return msg[offset : offset+length], true
+}
+
+// Find the server timestamp in the target info attribute/value pairs
+func ntlmTimestamp(targetInfo []byte) []byte {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+
+		if id == ntlmAvEOL || len(targetInfo) < 4+length {
+			return nil
+		}
+
+		if id == ntlmAvTimestamp && length == 8 {
+			return targetInfo[4:12]
+		}
+
+		targetInfo = targetInfo[4+length:]
+	}
+
+	return nil
+}
+
+func ntlmV2Hash(domain, user, password string) []byte {
+	hash := md4.New()
+	hash.Write(ntlmUnicode(password))
+
+	return hmacMd5(hash.Sum(nil), ntlmUnicode(strings.ToUpper(user)+domain))
+}
+
+func ntlmUnicode(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, len(encoded)*2)
+
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[i*2:], r)
+	}
+
+	return b
+}
+
+func ntlmOEM(s string) []byte {
+	return []byte(s)
+}
+
+func hmacMd5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,132 @@
+package webtools_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/scheiblingco/gofn/webtools"
+	"golang.org/x/crypto/md4"
+)
+
+var ntlmServerChallenge = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+func utf16le(s string) []byte {
+	b := []byte{}
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+
+	return b
+}
+
+func ntlmField(msg []byte, pos int) []byte {
+	length := binary.LittleEndian.Uint16(msg[pos:])
+	offset := binary.LittleEndian.Uint32(msg[pos+4:])
+
+	return msg[offset : offset+uint32(length)]
+}
+
+func ntlmChallengeMessage() []byte {
+	targetInfo := binary.LittleEndian.AppendUint16(nil, 2)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, uint16(len(utf16le("CORP"))))
+	targetInfo = append(targetInfo, utf16le("CORP")...)
+	targetInfo = append(targetInfo, 0, 0, 0, 0)
+
+	msg := make([]byte, 48)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], 0x00888205)
+	copy(msg[24:], ntlmServerChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+
+	return append(msg, targetInfo...)
+}
+
+// Verify the NTLMv2 response of an authenticate message for CORP\alice with password secret
+func ntlmValid(msg []byte) bool {
+	if len(msg) < 64 || binary.LittleEndian.Uint32(msg[8:]) != 3 {
+		return false
+	}
+
+	if !bytes.Equal(ntlmField(msg, 28), utf16le("CORP")) || !bytes.Equal(ntlmField(msg, 36), utf16le("alice")) {
+		return false
+	}
+
+	hash := md4.New()
+	hash.Write(utf16le("secret"))
+
+	key := hmac.New(md5.New, hash.Sum(nil))
+	key.Write(utf16le("ALICECORP"))
+
+	ntResponse := ntlmField(msg, 20)
+	proof := hmac.New(md5.New, key.Sum(nil))
+	proof.Write(ntlmServerChallenge)
+	proof.Write(ntResponse[16:])
+
+	return hmac.Equal(proof.Sum(nil), ntResponse[:16])
+}
+
+func TestNTLMAuth(t *testing.T) {
+	negotiatedFrom := ""
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "NTLM ")
+		msg, err := base64.StdEncoding.DecodeString(token)
+
+		if !ok || err != nil || len(msg) < 12 {
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch binary.LittleEndian.Uint32(msg[8:]) {
+		case 1:
+			negotiatedFrom = r.RemoteAddr
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(ntlmChallengeMessage()))
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			if r.RemoteAddr != negotiatedFrom {
+				t.Errorf("Expected the handshake to use one connection, got %s and %s", negotiatedFrom, r.RemoteAddr)
+			}
+
+			if !ntlmValid(msg) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	for _, auth := range []*webtools.NTLMAuth{
+		{Domain: "CORP", User: "alice", Password: "secret"},
+		{User: `CORP\alice`, Password: "secret"},
+		{Domain: "CORP", User: "alice", Password: "wrong"},
+	} {
+		resp, err := webtools.PostRequest(srv.URL).WithBodyString("payload").WithAuthorization(auth).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+
+		expected := http.StatusOK
+		if auth.Password == "wrong" {
+			expected = http.StatusUnauthorized
+		}
+
+		if resp.StatusCode != expected {
+			t.Errorf("Expected status %d for %s, got %d", expected, auth.Password, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package webtools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+type OAuth2Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int       `json:"expires_in"`
+	Expiry      time.Time `json:"-"`
+}
+
+// OAuth2ClientCredentials fetches an access token with the client credentials grant
+// and caches it until shortly before it expires. A 401 response invalidates the
+// cached token and the request is sent once more with a new token
+type OAuth2ClientCredentials struct {
+	TokenUrl     string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+	ExtraParams  map[string]string
+
+	// Send the client credentials as basic auth instead of in the form body
+	UseBasicAuth bool
+
+	// How long before expiry the token is refreshed, defaults to 30 seconds
+	ExpiryDelta time.Duration
+
+	HttpClient *http.Client
+
+	// Bounds the token request, defaults to 30 seconds
+	TokenTimeout time.Duration
+
+	mu    sync.Mutex
+	token *OAuth2Token
+	fetch *tokenFetch
+}
+
+// A token request shared by all requests waiting for a new token
+type tokenFetch struct {
+	done  chan struct{}
+	token *OAuth2Token
+	err   error
+}
+
+func (o *OAuth2ClientCredentials) Apply(req *RestRequest) *RestRequest {
+	token, err := o.Token(req)
+	if err != nil {
+		req.addError(err)
+		return req
+	}
+
+	return req.WithHeader("Authorization", token.authorizationHeader())
+}
+
+func (o *OAuth2ClientCredentials) Challenge(req *RestRequest, resp *RestResponse) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// Only drop the token if it is the one that was rejected, another request may already have refreshed it
+	if o.token != nil && o.token.authorizationHeader() == resp.Response.Request.Header.Get("Authorization") {
+		o.token = nil
+	}
+
+	return true, nil
+}
+
+// Return the cached token or fetch a new one. Concurrent requests share a single token request,
+// each of them stops waiting for it when its own context ends
+func (o *OAuth2ClientCredentials) Token(req *RestRequest) (*OAuth2Token, error) {
+	ctx := context.Background()
+	if req != nil && req.ctx != nil {
+		ctx = req.ctx
+	}
+
+	delta := o.ExpiryDelta
+	if delta == 0 {
+		delta = 30 * time.Second
+	}
+
+	o.mu.Lock()
+
+	if o.token != nil && (o.token.Expiry.IsZero() || time.Now().Add(delta).Before(o.token.Expiry)) {
+		token := o.token
+		o.mu.Unlock()
+		return token, nil
+	}
+
+	fetch := o.fetch
+	if fetch == nil {
+		fetch = &tokenFetch{done: make(chan struct{})}
+		o.fetch = fetch
+
+		// The token request outlives the request that started it, other requests may be waiting for it
+		go o.runFetch(context.WithoutCancel(ctx), fetch)
+	}
+
+	o.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (o *OAuth2ClientCredentials) runFetch(ctx context.Context, fetch *tokenFetch) {
+	timeout := o.TokenTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fetch.token, fetch.err = o.fetchToken(ctx)
+
+	o.mu.Lock()
+	if fetch.err == nil {
+		o.token = fetch.token
+	}
+	o.fetch = nil
+	o.mu.Unlock()
+
+	close(fetch.done)
+}
+
+func (o *OAuth2ClientCredentials) fetchToken(ctx context.Context) (*OAuth2Token, error) {
+	form := map[string]string{
+		"grant_type": "client_credentials",
+	}
+
+	if len(o.Scopes) > 0 {
+		form["scope"] = strings.Join(o.Scopes, " ")
+	}
+
+	for k, v := range o.ExtraParams {
+		form[k] = v
+	}
+
+	tokenReq := (&RestClient{HttpClient: o.HttpClient}).Post(o.TokenUrl).WithHeader("Accept", "application/json")
+
+	if o.UseBasicAuth {
+		tokenReq = tokenReq.WithAuthorization(&BasicAuth{Username: o.ClientId, Password: o.ClientSecret})
+	} else {
+		form["client_id"] = o.ClientId
+		form["client_secret"] = o.ClientSecret
+	}
+
+	resp, err := tokenReq.WithUrlencodedFormBody(form, nil).ExecuteContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errtools.AuthorizationError(fmt.Sprintf("token endpoint returned status %d", resp.StatusCode))
+	}
+
+	token := &OAuth2Token{}
+	if err := resp.UnmarshalJsonBody(token); err != nil {
+		return nil, err
+	}
+
+	if token.AccessToken == "" {
+		return nil, errtools.AuthorizationError("token endpoint returned no access token")
+	}
+
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func (t *OAuth2Token) authorizationHeader() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer " + t.AccessToken
+	}
+
+	return t.TokenType + " " + t.AccessToken
+}
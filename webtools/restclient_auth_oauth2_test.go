@@ -0,0 +1,171 @@
+package webtools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var issued atomic.Int32
+	var valid atomic.Value
+	valid.Store("")
+
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != "id" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token := fmt.Sprintf("token-%d", issued.Add(1))
+		valid.Store(token)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": token,
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenSrv.Close()
+
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiSrv.Close()
+
+	auth := &webtools.OAuth2ClientCredentials{
+		TokenUrl:     tokenSrv.URL,
+		ClientId:     "id",
+		ClientSecret: "secret",
+	}
+
+	client := webtools.NewRestClient(apiSrv.URL).WithAuthorization(auth)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Get("/").Execute()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected status code 200, got %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if issued.Load() != 1 {
+		t.Errorf("Expected the token to be cached, got %d token requests", issued.Load())
+	}
+
+	// Revoke the token on the server side, the next request has to refresh it
+	valid.Store("revoked")
+
+	resp, err := client.Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusOK || issued.Load() != 2 {
+		t.Errorf("Expected status 200 with a refreshed token, got %d after %d token requests", resp.StatusCode, issued.Load())
+	}
+}
+
+func TestOAuth2InvalidCredentials(t *testing.T) {
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer tokenSrv.Close()
+
+	auth := &webtools.OAuth2ClientCredentials{TokenUrl: tokenSrv.URL, ClientId: "id", ClientSecret: "wrong"}
+
+	if _, err := webtools.GetRequest(tokenSrv.URL).WithAuthorization(auth).Execute(); err == nil {
+		t.Error("Expected an error when the token request fails")
+	}
+}
+
+func TestOAuth2SlowTokenEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	var issued atomic.Int32
+
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		issued.Add(1)
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "slow", "expires_in": 3600})
+	}))
+	defer tokenSrv.Close()
+	defer close(release)
+
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiSrv.Close()
+
+	auth := &webtools.OAuth2ClientCredentials{TokenUrl: tokenSrv.URL, ClientId: "id", ClientSecret: "secret"}
+	client := webtools.NewRestClient(apiSrv.URL).WithAuthorization(auth)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	requests := map[string]func() error{
+		"context": func() error {
+			_, err := client.Get("/").ExecuteContext(ctx)
+			return err
+		},
+		"timeout": func() error {
+			_, err := client.Get("/").WithTimeout(100 * time.Millisecond).Execute()
+			return err
+		},
+	}
+
+	for name, request := range requests {
+		start := time.Now()
+		err := request()
+
+		var timeoutErr errtools.RequestTimeoutError
+		if !errors.As(err, &timeoutErr) || time.Since(start) > time.Second {
+			t.Errorf("%s: expected a timeout while waiting for the token, got %v after %s", name, err, time.Since(start))
+		}
+	}
+
+	// Both requests waited for the same token request, which still completes for later requests
+	release <- struct{}{}
+
+	resp, err := client.Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if issued.Load() != 1 {
+		t.Errorf("Expected a single token request, got %d", issued.Load())
+	}
+}
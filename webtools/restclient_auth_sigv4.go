@@ -0,0 +1,312 @@
+package webtools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	sigV4DateFormat      = "20060102"
+	sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// Headers that are changed by proxies or the transport and must not be signed
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"content-length":  true,
+	"connection":      true,
+	"expect":          true,
+	"x-amzn-trace-id": true,
+}
+
+// SigV4Auth signs requests with AWS Signature Version 4.
+// For the s3 service the X-Amz-Content-Sha256 header is always sent and paths are not normalized
+type SigV4Auth struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+
+	// Sign the payload as UNSIGNED-PAYLOAD instead of hashing the body, only supported by s3
+	UnsignedPayload bool
+}
+
+func (s *SigV4Auth) Apply(req *RestRequest) *RestRequest {
+	httpReq, err := http.NewRequest(string(req.Method), req.Url, nil)
+	if err != nil {
+		req.addError(err)
+		return req
+	}
+
+	httpReq.Header = req.effectiveHeader()
+
+	var payloadHash string
+
+	switch {
+	case s.UnsignedPayload:
+		payloadHash = sigV4UnsignedPayload
+	case req.BodyReader == nil:
+		payloadHash = sha256Hex(nil)
+	case req.replayable():
+		payloadHash = sha256Hex(req.body)
+	case s.Service == "s3":
+		payloadHash = sigV4UnsignedPayload
+	default:
+		req.addError(errtools.InvalidTypeError("sigv4 requires a body set from bytes to compute the payload hash"))
+		return req
+	}
+
+	if err := s.sign(httpReq, payloadHash, time.Now()); err != nil {
+		req.addError(err)
+		return req
+	}
+
+	for _, header := range []string{"Authorization", "X-Amz-Date", "X-Amz-Content-Sha256", "X-Amz-Security-Token"} {
+		if value := httpReq.Header.Get(header); value != "" {
+			req = req.WithHeader(header, value)
+		}
+	}
+
+	return req
+}
+
+// Sign an http.Request with the given body at the given time, the signature headers are set on the request
+func (s *SigV4Auth) SignRequest(req *http.Request, body []byte, signTime time.Time) error {
+	payloadHash := sha256Hex(body)
+	if s.UnsignedPayload {
+		payloadHash = sigV4UnsignedPayload
+	}
+
+	return s.sign(req, payloadHash, signTime)
+}
+
+// Create a presigned url that is valid for the given duration from signTime
+func (s *SigV4Auth) PresignUrl(method RequestMethod, rawUrl string, expires time.Duration, signTime time.Time) (string, error) {
+	if err := s.validate(); err != nil {
+		return "", err
+	}
+
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	signTime = signTime.UTC()
+	scope := s.scope(signTime)
+
+	query := parsed.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", signTime.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	if s.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	parsed.RawQuery = sigV4CanonicalQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		string(method),
+		s.canonicalUri(parsed),
+		parsed.RawQuery,
+		"host:" + parsed.Host + "\n",
+		"host",
+		sigV4UnsignedPayload,
+	}, "\n")
+
+	parsed.RawQuery += "&X-Amz-Signature=" + s.signature(canonicalRequest, signTime)
+
+	return parsed.String(), nil
+}
+
+func (s *SigV4Auth) sign(req *http.Request, payloadHash string, signTime time.Time) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	signTime = signTime.UTC()
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", signTime.Format(sigV4TimeFormat))
+
+	if s.Service == "s3" || payloadHash == sigV4UnsignedPayload {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for k, values := range req.Header {
+		name := strings.ToLower(k)
+		if sigV4IgnoredHeaders[name] {
+			continue
+		}
+
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+
+		headers[name] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := strings.Builder{}
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalUri(req.URL),
+		sigV4CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.AccessKey, s.scope(signTime), signedHeaders, s.signature(canonicalRequest, signTime)))
+
+	return nil
+}
+
+func (s *SigV4Auth) validate() error {
+	switch {
+	case s.AccessKey == "":
+		return errtools.MissingValueError("access key")
+	case s.SecretKey == "":
+		return errtools.MissingValueError("secret key")
+	case s.Region == "":
+		return errtools.MissingValueError("region")
+	case s.Service == "":
+		return errtools.MissingValueError("service")
+	}
+
+	return nil
+}
+
+func (s *SigV4Auth) scope(signTime time.Time) string {
+	return signTime.Format(sigV4DateFormat) + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+func (s *SigV4Auth) signature(canonicalRequest string, signTime time.Time) string {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		signTime.Format(sigV4TimeFormat),
+		s.scope(signTime),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.SecretKey), signTime.Format(sigV4DateFormat))
+	key = hmacSha256(key, s.Region)
+	key = hmacSha256(key, s.Service)
+	key = hmacSha256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSha256(key, stringToSign))
+}
+
+// S3 uses the path as-is, other services normalize it and encode it twice
+func (s *SigV4Auth) canonicalUri(u *url.URL) string {
+	uriPath := u.Path
+	if uriPath == "" {
+		return "/"
+	}
+
+	if s.Service == "s3" {
+		return sigV4Escape(uriPath, false)
+	}
+
+	cleaned := path.Clean(uriPath)
+	if strings.HasSuffix(uriPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return sigV4Escape(sigV4Escape(cleaned, false), false)
+}
+
+// Parameters are sorted by encoded key and then by encoded value
+func sigV4CanonicalQuery(query url.Values) string {
+	params := [][2]string{}
+
+	for k, values := range query {
+		for _, v := range values {
+			params = append(params, [2]string{sigV4Escape(k, true), sigV4Escape(v, true)})
+		}
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+
+		return params[i][1] < params[j][1]
+	})
+
+	encoded := make([]string, len(params))
+	for i, param := range params {
+		encoded[i] = param[0] + "=" + param[1]
+	}
+
+	return strings.Join(encoded, "&")
+}
+
+// Percent-encode everything except unreserved characters, slashes are kept unless encodeSlash is set
+func sigV4Escape(s string, encodeSlash bool) string {
+	escaped := strings.Builder{}
+
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
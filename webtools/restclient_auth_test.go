@@ -0,0 +1,114 @@
+package webtools_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func TestChainAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer from-source" {
+			t.Errorf("Expected bearer token from source, got %q", r.Header.Get("Authorization"))
+		}
+
+		if r.Header.Get("X-Api-Key") != "header-key" {
+			t.Errorf("Expected api key header, got %q", r.Header.Get("X-Api-Key"))
+		}
+
+		if r.URL.Query().Get("api_key") != "query key" || r.URL.Query().Get("page") != "2" {
+			t.Errorf("Expected api key and page in query, got %q", r.URL.RawQuery)
+		}
+
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "cookie-key" {
+			t.Errorf("Expected api key cookie, got %v", cookie)
+		}
+
+		if cookie, err := r.Cookie("theme"); err != nil || cookie.Value != "dark" {
+			t.Errorf("Expected existing cookie to be kept, got %v", cookie)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	auth := webtools.ChainAuth{
+		&webtools.BearerToken{TokenSource: func() (string, error) { return "from-source", nil }},
+		&webtools.APIKey{Name: "X-Api-Key", Value: "header-key"},
+		&webtools.APIKey{Name: "api_key", Value: "query key", Placement: webtools.APIKeyInQuery},
+		&webtools.APIKey{Name: "session", Value: "cookie-key", Placement: webtools.APIKeyInCookie},
+	}
+
+	resp, err := webtools.GetRequest(srv.URL+"?page=2").
+		WithHeader("Cookie", "theme=dark").
+		WithAuthorization(auth).
+		WithRetry(webtools.DefaultRetryPolicy()).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestBearerTokenMissing(t *testing.T) {
+	_, err := webtools.GetRequest("http://localhost").WithAuthorization(&webtools.BearerToken{}).Execute()
+	if err == nil {
+		t.Error("Expected an error for an empty bearer token")
+	}
+}
+
+// Returns a modified copy instead of changing the request
+type cloningAuth struct{}
+
+func (cloningAuth) Apply(req *webtools.RestRequest) *webtools.RestRequest {
+	return req.Clone().WithHeader("X-Signed", "yes")
+}
+
+func TestAuthorizationReturningCopy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Signed") != "yes" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	resp, err := webtools.GetRequest(srv.URL).WithAuthorization(cloningAuth{}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the headers of the returned request to be sent, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIKeyInQueryRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != "SECRET" {
+			t.Errorf("Expected the api key in the sent url, got %q", r.URL.RawQuery)
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	req := webtools.GetRequest(srv.URL + "/p?page=1").
+		WithAuthorization(&webtools.APIKey{Name: "api_key", Value: "SECRET", Placement: webtools.APIKeyInQuery})
+
+	_, err := webtools.Do[string](req)
+
+	statusErr := errtools.HTTPStatusError{}
+	if !errors.As(err, &statusErr) || strings.Contains(err.Error(), "SECRET") || !strings.Contains(statusErr.Url, "api_key=REDACTED") {
+		t.Errorf("Expected the api key to be redacted from the error, got %v", err)
+	}
+
+	if strings.Contains(req.Url, "SECRET") {
+		t.Errorf("Expected the api key to stay out of the request url, got %s", req.Url)
+	}
+}
@@ -0,0 +1,456 @@
+package webtools
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheStatus string
+
+const (
+	// The response was fetched from the server and stored if it was cacheable
+	CacheMiss CacheStatus = "miss"
+	// The response was served from the cache without contacting the server
+	CacheHit CacheStatus = "hit"
+	// The server confirmed the cached response with 304 Not Modified
+	CacheRevalidated CacheStatus = "revalidated"
+)
+
+// Largest body stored by a Cache unless MaxEntrySize is set
+var DefaultMaxCacheEntrySize int64 = 10 << 20
+
+// CacheStore holds cached responses. Stores are used by several requests at once and
+// failing to read or write an entry is treated as a cache miss
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, entry *CachedResponse)
+	Delete(key string)
+}
+
+// CachedResponse is a stored response, only the variant for the last Vary request headers
+// is kept for each url
+type CachedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+
+	// Request header values for the headers listed in the Vary response header
+	VaryHeader http.Header `json:"vary_header,omitempty"`
+
+	// The response is fresh until Expires, afterwards it is revalidated with the server
+	Expires time.Time `json:"expires"`
+}
+
+// Cache stores GET responses according to their Cache-Control, Expires and Vary headers.
+// Stale responses with an ETag or Last-Modified header are revalidated with a conditional
+// request. Responses to requests with credentials are only stored when they are public.
+// Install it with RestClient.WithCache or as middleware on a request
+type Cache struct {
+	Store CacheStore
+
+	// Larger responses are not stored, DefaultMaxCacheEntrySize when zero
+	MaxEntrySize int64
+}
+
+func NewCache(store CacheStore) *Cache {
+	return &Cache{Store: store}
+}
+
+// Add a cache to the client, it runs as client middleware
+func (c *RestClient) WithCache(cache *Cache) *RestClient {
+	return c.WithMiddleware(cache.Middleware())
+}
+
+func (c *Cache) Middleware() Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*RestResponse, error) {
+			return c.do(next, req)
+		})
+	}
+}
+
+func (c *Cache) do(next Doer, req *http.Request) (*RestResponse, error) {
+	key := redactedUrl(req).String()
+
+	if req.Method != http.MethodGet {
+		resp, err := next.Do(req)
+
+		// A successful unsafe request invalidates the cached response for the url
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && resp.StatusCode < 400 {
+			c.Store.Delete(key)
+		}
+
+		return resp, err
+	}
+
+	reqControl := parseCacheControl(req.Header)
+	if _, ok := reqControl["no-store"]; ok || req.Header.Get("Range") != "" {
+		return next.Do(req)
+	}
+
+	now := time.Now()
+	entry, ok := c.Store.Get(key)
+	if ok && !entry.matchesVary(req.Header) {
+		entry, ok = nil, false
+	}
+
+	if ok {
+		_, noCache := reqControl["no-cache"]
+		_, mustRevalidate := parseCacheControl(entry.Header)["no-cache"]
+
+		if !noCache && !mustRevalidate && now.Before(entry.Expires) {
+			return entry.response(req, CacheHit), nil
+		}
+
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			req.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	resp, err := next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.discard()
+
+		for k, values := range resp.Response.Header {
+			entry.Header[k] = values
+		}
+
+		entry.Expires = freshUntil(entry.Header, now)
+		c.Store.Set(key, entry)
+
+		return entry.response(req, CacheRevalidated), nil
+	}
+
+	resp.CacheStatus = CacheMiss
+
+	if !c.cacheable(resp) {
+		if _, noStore := parseCacheControl(resp.Response.Header)["no-store"]; noStore {
+			c.Store.Delete(key)
+		}
+
+		return resp, nil
+	}
+
+	// Another user's credentials would be served the response
+	if _, public := parseCacheControl(resp.Response.Header)["public"]; hasCredentials(req) && !public {
+		return resp, nil
+	}
+
+	return c.store(key, req, resp, now)
+}
+
+// Read the body of a cacheable response into the store and return a response with the same body
+func (c *Cache) store(key string, req *http.Request, resp *RestResponse, now time.Time) (*RestResponse, error) {
+	limit := c.MaxEntrySize
+	if limit <= 0 {
+		limit = DefaultMaxCacheEntrySize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Response.Body, limit+1))
+	if err != nil {
+		resp.Response.Body.Close()
+		return nil, err
+	}
+
+	if int64(len(body)) > limit {
+		// Too large to cache, hand the rest of the body to the caller as it is
+		resp.Response.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Response.Body), resp.Response.Body}
+
+		return resp, nil
+	}
+
+	resp.Response.Body.Close()
+	resp.Response.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &CachedResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Response.Status,
+		Header:     resp.Response.Header.Clone(),
+		Body:       body,
+		VaryHeader: http.Header{},
+		Expires:    freshUntil(resp.Response.Header, now),
+	}
+
+	for _, name := range varyHeaders(resp.Response.Header) {
+		entry.VaryHeader[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+	}
+
+	c.Store.Set(key, entry)
+
+	return resp, nil
+}
+
+// Only complete 200 responses that are fresh for a while or can be revalidated are stored
+func (c *Cache) cacheable(resp *RestResponse) bool {
+	header := resp.Response.Header
+	control := parseCacheControl(header)
+
+	if _, ok := control["no-store"]; ok || resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	if slices.Contains(varyHeaders(header), "*") {
+		return false
+	}
+
+	validator := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+
+	return validator || freshUntil(header, time.Now()).After(time.Now())
+}
+
+// Requests with an Authorization header or an api key in the query carry credentials
+func hasCredentials(req *http.Request) bool {
+	names, _ := req.Context().Value(redactedQueryKey{}).([]string)
+	return req.Header.Get("Authorization") != "" || len(names) > 0
+}
+
+func (cr *CachedResponse) matchesVary(header http.Header) bool {
+	for name, values := range cr.VaryHeader {
+		if !slices.Equal(header.Values(name), values) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (cr *CachedResponse) response(req *http.Request, status CacheStatus) *RestResponse {
+	resp := NewRestResponse(&http.Response{
+		StatusCode:    cr.StatusCode,
+		Status:        cr.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cr.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(cr.Body)),
+		ContentLength: int64(len(cr.Body)),
+		Request:       req,
+	})
+
+	resp.CacheStatus = status
+
+	return resp
+}
+
+// Freshness from max-age, reduced by the Age header, or from the Expires header
+func freshUntil(header http.Header, now time.Time) time.Time {
+	control := parseCacheControl(header)
+
+	if maxAge, ok := control["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return now
+		}
+
+		age, _ := strconv.Atoi(header.Get("Age"))
+
+		return now.Add(time.Duration(seconds-age) * time.Second)
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		expiry, err := http.ParseTime(expires)
+		if err != nil {
+			return now
+		}
+
+		// Compare with the server clock when the response is dated
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			return now.Add(expiry.Sub(date))
+		}
+
+		return expiry
+	}
+
+	return now
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+
+	return directives
+}
+
+func varyHeaders(header http.Header) []string {
+	names := []string{}
+
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// MemoryCacheStore keeps up to MaxEntries responses in memory and evicts the least recently used
+type MemoryCacheStore struct {
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryCacheEntry struct {
+	key   string
+	entry *CachedResponse
+}
+
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		MaxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+func (m *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	m.order.MoveToFront(elem)
+
+	return elem.Value.(*memoryCacheEntry).entry.clone(), true
+}
+
+func (m *MemoryCacheStore) Set(key string, entry *CachedResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*memoryCacheEntry).entry = entry.clone()
+		m.order.MoveToFront(elem)
+		return
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryCacheEntry{key: key, entry: entry.clone()})
+
+	for m.MaxEntries > 0 && m.order.Len() > m.MaxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+func (m *MemoryCacheStore) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.order.Remove(elem)
+		delete(m.entries, key)
+	}
+}
+
+func (m *MemoryCacheStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.order.Len()
+}
+
+// DiskCacheStore keeps each response as a json file in Dir, named by the hash of its key
+type DiskCacheStore struct {
+	Dir string
+}
+
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &DiskCacheStore{Dir: dir}, nil
+}
+
+func (d *DiskCacheStore) Get(key string) (*CachedResponse, bool) {
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &CachedResponse{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func (d *DiskCacheStore) Set(key string, entry *CachedResponse) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(d.Dir, "entry.*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err != nil || closeErr != nil {
+		return
+	}
+
+	os.Rename(tmp.Name(), d.path(key))
+}
+
+func (d *DiskCacheStore) Delete(key string) {
+	os.Remove(d.path(key))
+}
+
+func (d *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (cr *CachedResponse) clone() *CachedResponse {
+	clone := *cr
+	clone.Header = cr.Header.Clone()
+	clone.VaryHeader = cr.VaryHeader.Clone()
+
+	return &clone
+}
@@ -0,0 +1,208 @@
+package webtools_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/webtools"
+	"github.com/scheiblingco/gofn/webtools/webtest"
+)
+
+func fetchCached(t *testing.T, client *webtools.RestClient, path string, headers map[string]string) (string, webtools.CacheStatus) {
+	resp, err := client.Get(path).WithHeaders(headers).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyAsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body, resp.CacheStatus
+}
+
+func TestCache(t *testing.T) {
+	srv := webtest.NewServer(t)
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+
+	// Fetched again when the request bypasses the cache and after the post that invalidates it
+	srv.Expect(webtools.GET, "/fresh").WithResponseHeader("Cache-Control", "max-age=60").
+		Respond(http.StatusOK, "fresh v0").
+		Respond(http.StatusOK, "fresh v0").
+		Respond(http.StatusOK, "fresh v1").
+		Times(3)
+
+	srv.Expect(webtools.POST, "/fresh").Respond(http.StatusOK, "")
+
+	// Revalidated once, the second conditional request returns a new version
+	srv.Expect(webtools.GET, "/etag").WithHeader("If-None-Match", `"v0"`).
+		WithResponseHeader("Cache-Control", "no-cache").
+		Respond(http.StatusNotModified, "").
+		RespondWith(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("etag v1"))
+		}).
+		Times(2)
+
+	srv.Expect(webtools.GET, "/etag").
+		WithResponseHeader("Cache-Control", "no-cache").
+		WithResponseHeader("ETag", `"v0"`).
+		Respond(http.StatusOK, "etag v0")
+
+	srv.Expect(webtools.GET, "/modified").WithHeader("If-Modified-Since", modified).
+		Respond(http.StatusNotModified, "")
+
+	srv.Expect(webtools.GET, "/modified").
+		WithResponseHeader("Last-Modified", modified).
+		Respond(http.StatusOK, "modified")
+
+	srv.Expect(webtools.GET, "/private").
+		WithResponseHeader("Cache-Control", "no-store").
+		Respond(http.StatusOK, "private").
+		Times(2)
+
+	for _, language := range []string{"en", "de"} {
+		srv.Expect(webtools.GET, "/vary").WithHeader("Accept-Language", language).
+			WithResponseHeader("Cache-Control", "max-age=60").
+			WithResponseHeader("Vary", "Accept-Language").
+			Respond(http.StatusOK, language)
+	}
+
+	client := webtools.NewRestClient(srv.URL).WithCache(webtools.NewCache(webtools.NewMemoryCacheStore(10)))
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		body    string
+		status  webtools.CacheStatus
+	}{
+		{"/fresh", nil, "fresh v0", webtools.CacheMiss},
+		{"/fresh", nil, "fresh v0", webtools.CacheHit},
+		{"/fresh", map[string]string{"Cache-Control": "no-cache"}, "fresh v0", webtools.CacheMiss},
+		{"/etag", nil, "etag v0", webtools.CacheMiss},
+		{"/etag", nil, "etag v0", webtools.CacheRevalidated},
+		{"/modified", nil, "modified", webtools.CacheMiss},
+		{"/modified", nil, "modified", webtools.CacheRevalidated},
+		{"/private", nil, "private", webtools.CacheMiss},
+		{"/private", nil, "private", webtools.CacheMiss},
+		{"/vary", map[string]string{"Accept-Language": "en"}, "en", webtools.CacheMiss},
+		{"/vary", map[string]string{"Accept-Language": "en"}, "en", webtools.CacheHit},
+		{"/vary", map[string]string{"Accept-Language": "de"}, "de", webtools.CacheMiss},
+	}
+
+	for _, test := range tests {
+		if body, status := fetchCached(t, client, test.path, test.headers); body != test.body || status != test.status {
+			t.Errorf("%s: expected %q (%s), got %q (%s)", test.path, test.body, test.status, body, status)
+		}
+	}
+
+	// A new version is fetched when the etag changes, and a successful post drops the cached response
+	if body, status := fetchCached(t, client, "/etag", nil); body != "etag v1" || status != webtools.CacheMiss {
+		t.Errorf("Expected the changed response, got %q (%s)", body, status)
+	}
+
+	resp, err := client.Post("/fresh").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if body, status := fetchCached(t, client, "/fresh", nil); body != "fresh v1" || status != webtools.CacheMiss {
+		t.Errorf("Expected the post to invalidate the cached response, got %q (%s)", body, status)
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	srv := webtest.NewServer(t)
+
+	// Responses for different credentials are not shared unless they are public
+	for _, user := range []string{"a", "b"} {
+		srv.Expect(webtools.GET, "/account").WithHeader("Authorization", "Bearer "+user).
+			WithResponseHeader("Cache-Control", "max-age=60").
+			Respond(http.StatusOK, user).Times(2)
+
+		srv.Expect(webtools.GET, "/account").WithQuery("key", user).
+			WithResponseHeader("Cache-Control", "max-age=60").
+			Respond(http.StatusOK, user).Times(2)
+	}
+
+	srv.Expect(webtools.GET, "/shared").
+		WithResponseHeader("Cache-Control", "public, max-age=60").
+		Respond(http.StatusOK, "shared")
+
+	client := webtools.NewRestClient(srv.URL).WithCache(webtools.NewCache(webtools.NewMemoryCacheStore(10)))
+
+	tests := []struct {
+		path   string
+		auth   webtools.Authorization
+		body   string
+		status webtools.CacheStatus
+	}{
+		{"/account", &webtools.BearerToken{Token: "a"}, "a", webtools.CacheMiss},
+		{"/account", &webtools.BearerToken{Token: "b"}, "b", webtools.CacheMiss},
+		{"/account", &webtools.BearerToken{Token: "a"}, "a", webtools.CacheMiss},
+		{"/account", &webtools.APIKey{Name: "key", Value: "a", Placement: webtools.APIKeyInQuery}, "a", webtools.CacheMiss},
+		{"/account", &webtools.APIKey{Name: "key", Value: "b", Placement: webtools.APIKeyInQuery}, "b", webtools.CacheMiss},
+		{"/account", &webtools.APIKey{Name: "key", Value: "a", Placement: webtools.APIKeyInQuery}, "a", webtools.CacheMiss},
+		{"/account", &webtools.BearerToken{Token: "b"}, "b", webtools.CacheMiss},
+		{"/account", &webtools.APIKey{Name: "key", Value: "b", Placement: webtools.APIKeyInQuery}, "b", webtools.CacheMiss},
+		{"/shared", &webtools.BearerToken{Token: "a"}, "shared", webtools.CacheMiss},
+		{"/shared", &webtools.BearerToken{Token: "b"}, "shared", webtools.CacheHit},
+	}
+
+	for i, test := range tests {
+		resp, err := client.Get(test.path).WithAuthorization(test.auth).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if body, _ := resp.BodyAsString(); body != test.body || resp.CacheStatus != test.status {
+			t.Errorf("Request %d: expected %q (%s), got %q (%s)", i, test.body, test.status, body, resp.CacheStatus)
+		}
+	}
+}
+
+func TestMemoryCacheStoreEviction(t *testing.T) {
+	store := webtools.NewMemoryCacheStore(2)
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		if _, ok := store.Get(key); !ok {
+			store.Set(key, &webtools.CachedResponse{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(key)})
+		}
+	}
+
+	if _, ok := store.Get("b"); ok || store.Len() != 2 {
+		t.Errorf("Expected the least recently used entry to be evicted, %d entries left", store.Len())
+	}
+
+	if entry, ok := store.Get("a"); !ok || string(entry.Body) != "a" {
+		t.Error("Expected the recently used entry to be kept")
+	}
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	srv := webtest.NewServer(t)
+
+	// Only the first run reaches the server
+	srv.Expect(webtools.GET, "/fresh").
+		WithResponseHeader("Cache-Control", "max-age=60").
+		Respond(http.StatusOK, "fresh")
+
+	dir := t.TempDir()
+
+	for i, expected := range []webtools.CacheStatus{webtools.CacheMiss, webtools.CacheHit} {
+		// Every iteration uses a new store and client, like a restarted process
+		store, err := webtools.NewDiskCacheStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := webtools.NewRestClient(srv.URL).WithCache(webtools.NewCache(store))
+
+		if body, status := fetchCached(t, client, "/fresh", nil); body != "fresh" || status != expected {
+			t.Errorf("Run %d: expected %s, got %q (%s)", i, expected, body, status)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package webtools
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"gopkg.in/yaml.v2"
+)
+
+type CassetteMode int
+
+const (
+	// Serve requests from the cassette only, requests without a recorded interaction fail
+	CassetteReplay CassetteMode = iota
+	// Send every request and record it, replacing the previous content of the cassette
+	CassetteRecord
+	// Serve recorded interactions and send and record requests that have none
+	CassetteReplayOrRecord
+)
+
+// Value stored instead of the value of a redacted header
+const CassetteRedacted = "REDACTED"
+
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Decide whether a recorded request matches the request being sent
+type CassetteMatcher func(req *http.Request, body []byte, recorded *CassetteRequest) bool
+
+// Cassette is a transport that records request and response pairs into a yaml or json file and
+// replays them, so tests against real services can run offline. Install it with NewRestClient or
+// GetHttpClient, it wraps the transport already set on the client when recording. Options that
+// configure the transport, like WithClientCertificate, may be given before or after the cassette
+type Cassette struct {
+	// Files ending in .yaml or .yml are stored as yaml, others as json
+	Path string
+	Mode CassetteMode
+
+	// Request headers compared by the default matcher in addition to method and url,
+	// a redacted header matches any value
+	MatchHeaders []string
+	// Compare request bodies in the default matcher
+	MatchBody bool
+	// Replaces the default matcher
+	Matcher CassetteMatcher
+
+	// Headers stored as CassetteRedacted in requests and responses, DefaultRedactedHeaders when nil
+	RedactHeaders []string
+
+	// Transport used to send requests that are recorded, http.DefaultTransport when nil
+	Transport http.RoundTripper
+
+	Interactions []*CassetteInteraction
+
+	mu     sync.Mutex
+	played []bool
+}
+
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request" yaml:"request"`
+	Response CassetteResponse `json:"response" yaml:"response"`
+}
+
+type CassetteRequest struct {
+	Method  string              `json:"method" yaml:"method"`
+	Url     string              `json:"url" yaml:"url"`
+	Headers map[string][]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    CassetteBody        `json:"body" yaml:"body"`
+}
+
+type CassetteResponse struct {
+	StatusCode int                 `json:"status_code" yaml:"status_code"`
+	Status     string              `json:"status" yaml:"status"`
+	Headers    map[string][]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body       CassetteBody        `json:"body" yaml:"body"`
+}
+
+// Bodies that are not valid utf-8 are stored base64 encoded
+type CassetteBody struct {
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	Data     string `json:"data" yaml:"data"`
+}
+
+type cassetteFile struct {
+	Interactions []*CassetteInteraction `json:"interactions" yaml:"interactions"`
+}
+
+// Open the cassette at path, recorded interactions are loaded unless the mode is CassetteRecord
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{
+		Path: path,
+		Mode: mode,
+	}
+
+	if mode == CassetteRecord {
+		return c, nil
+	}
+
+	err := c.Load()
+	if err != nil && (mode == CassetteReplay || !errors.Is(err, os.ErrNotExist)) {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Cassette) Apply(client *http.Client) {
+	if c.Transport == nil && client.Transport != c {
+		c.Transport = client.Transport
+	}
+
+	client.Transport = c
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Mode != CassetteRecord {
+		if interaction := c.find(req, body); interaction != nil {
+			return interaction.Response.httpResponse(req)
+		}
+
+		if c.Mode == CassetteReplay {
+			return nil, errtools.CassetteMismatchError(req.Method + " " + redactedUrl(req).String())
+		}
+	}
+
+	return c.record(req, body)
+}
+
+// Write the recorded interactions to the file
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	file := cassetteFile{Interactions: c.Interactions}
+
+	var data []byte
+	var err error
+
+	if c.yaml() {
+		data, err = yaml.Marshal(file)
+	} else {
+		data, err = json.MarshalIndent(file, "", "  ")
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.Path, data, 0o644)
+}
+
+// Replace the interactions with those stored in the file
+func (c *Cassette) Load() error {
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+
+	file := cassetteFile{}
+
+	if c.yaml() {
+		err = yaml.Unmarshal(data, &file)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Interactions = file.Interactions
+	c.played = nil
+
+	return nil
+}
+
+// Interactions are played in the order they were recorded, once all matching
+// interactions have been played the first one is repeated
+func (c *Cassette) find(req *http.Request, body []byte) *CassetteInteraction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.played) != len(c.Interactions) {
+		c.played = make([]bool, len(c.Interactions))
+	}
+
+	var repeat *CassetteInteraction
+
+	for i, interaction := range c.Interactions {
+		if !c.matches(req, body, &interaction.Request) {
+			continue
+		}
+
+		if !c.played[i] {
+			c.played[i] = true
+			return interaction
+		}
+
+		if repeat == nil {
+			repeat = interaction
+		}
+	}
+
+	return repeat
+}
+
+func (c *Cassette) matches(req *http.Request, body []byte, recorded *CassetteRequest) bool {
+	if c.Matcher != nil {
+		return c.Matcher(req, body, recorded)
+	}
+
+	if !strings.EqualFold(req.Method, recorded.Method) || !sameUrl(redactedUrl(req), recorded.Url) {
+		return false
+	}
+
+	for _, key := range c.MatchHeaders {
+		values := http.Header(recorded.Headers).Values(key)
+		if slices.Equal(values, []string{CassetteRedacted}) {
+			continue
+		}
+
+		if !slices.Equal(req.Header.Values(key), values) {
+			return false
+		}
+	}
+
+	if c.MatchBody {
+		recordedBody, err := recorded.Body.bytes()
+		if err != nil || !bytes.Equal(body, recordedBody) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Cassette) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	sent := req.Clone(req.Context())
+	sent.Body = io.NopCloser(bytes.NewReader(body))
+	if req.Body == nil {
+		sent.Body = nil
+	}
+
+	resp, err := transport.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &CassetteInteraction{
+		Request: CassetteRequest{
+			Method:  req.Method,
+			Url:     redactedUrl(req).String(),
+			Headers: c.redact(req.Header),
+			Body:    newCassetteBody(body),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Headers:    c.redact(resp.Header),
+			Body:       newCassetteBody(respBody),
+		},
+	}
+
+	c.mu.Lock()
+	c.Interactions = append(c.Interactions, interaction)
+	c.played = append(c.played, true)
+	c.mu.Unlock()
+
+	if err := c.Save(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *Cassette) redact(header http.Header) map[string][]string {
+	redacted := header.Clone()
+
+	keys := c.RedactHeaders
+	if keys == nil {
+		keys = DefaultRedactedHeaders
+	}
+
+	for _, key := range keys {
+		if _, ok := redacted[http.CanonicalHeaderKey(key)]; ok {
+			redacted[http.CanonicalHeaderKey(key)] = []string{CassetteRedacted}
+		}
+	}
+
+	return redacted
+}
+
+func (c *Cassette) yaml() bool {
+	ext := strings.ToLower(filepath.Ext(c.Path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func (cr *CassetteResponse) httpResponse(req *http.Request) (*http.Response, error) {
+	body, err := cr.Body.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	status := cr.Status
+	if status == "" {
+		status = http.StatusText(cr.StatusCode)
+	}
+
+	return &http.Response{
+		StatusCode:    cr.StatusCode,
+		Status:        status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(cr.Headers).Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func newCassetteBody(body []byte) CassetteBody {
+	if utf8.Valid(body) {
+		return CassetteBody{Data: string(body)}
+	}
+
+	return CassetteBody{Encoding: "base64", Data: base64.StdEncoding.EncodeToString(body)}
+}
+
+func (cb CassetteBody) bytes() ([]byte, error) {
+	if cb.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(cb.Data)
+	}
+
+	return []byte(cb.Data), nil
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return []byte{}, nil
+	}
+
+	defer req.Body.Close()
+
+	return io.ReadAll(req.Body)
+}
+
+// Urls match when everything but the order of the query parameters is equal
+func sameUrl(u *url.URL, recorded string) bool {
+	parsed, err := url.Parse(recorded)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == parsed.Scheme && u.Host == parsed.Host && u.Path == parsed.Path &&
+		u.Query().Encode() == parsed.Query().Encode()
+}
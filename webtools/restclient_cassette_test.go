@@ -0,0 +1,227 @@
+package webtools_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+var binaryPayload = []byte{0x00, 0xff, 0xfe, 0x10, 0x80}
+
+func cassetteServer(calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+
+		switch r.URL.Path {
+		case "/users":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"created":` + string(body) + `}`))
+		case "/blob":
+			w.Write(binaryPayload)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	for _, name := range []string{"cassette.yaml", "cassette.json"} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			srv := cassetteServer(&calls)
+
+			path := filepath.Join(t.TempDir(), "cassettes", name)
+
+			recorder, err := webtools.NewCassette(path, webtools.CassetteRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			send := func(client *webtools.RestClient) (string, []byte) {
+				resp, err := client.Post("/users").
+					WithAuthorization(&webtools.BearerToken{Token: "top-secret"}).
+					WithJsonBody(`{"name":"alice"}`, nil).
+					Execute()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				created, err := resp.BodyAsString()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if resp.StatusCode != http.StatusCreated {
+					t.Errorf("Expected status 201, got %d", resp.StatusCode)
+				}
+
+				blob, err := webtools.Do[[]byte](client.Get("/blob?b=2&a=1").
+					WithAuthorization(&webtools.APIKey{Name: "key", Value: "query-secret", Placement: webtools.APIKeyInQuery}))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return created, blob
+			}
+
+			created, blob := send(webtools.NewRestClient(srv.URL, recorder))
+			srv.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(data), "top-secret") || strings.Contains(string(data), "session=secret") || strings.Contains(string(data), "query-secret") {
+				t.Errorf("Expected secrets to be redacted, got %s", data)
+			}
+
+			// The server is gone, the requests are served from the cassette
+			player, err := webtools.NewCassette(path, webtools.CassetteReplay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			player.MatchBody = true
+			player.MatchHeaders = []string{"Authorization", "Content-Type"}
+
+			replayedCreated, replayedBlob := send(webtools.NewRestClient(srv.URL, player))
+
+			if replayedCreated != created || replayedCreated != `{"created":{"name":"alice"}}` {
+				t.Errorf("Expected the recorded body, got %q", replayedCreated)
+			}
+
+			if !bytes.Equal(replayedBlob, blob) || !bytes.Equal(blob, binaryPayload) {
+				t.Errorf("Expected the recorded binary body, got %v", replayedBlob)
+			}
+
+			if calls != 2 {
+				t.Errorf("Expected the server to be called only while recording, got %d calls", calls)
+			}
+		})
+	}
+}
+
+func TestCassetteReplayMismatch(t *testing.T) {
+	calls := 0
+	srv := cassetteServer(&calls)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, _ := webtools.NewCassette(path, webtools.CassetteRecord)
+	resp, err := webtools.NewRestClient(srv.URL, recorder).Post("/users").WithBodyString("1").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	player, err := webtools.NewCassette(path, webtools.CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	player.MatchBody = true
+
+	client := webtools.NewRestClient(srv.URL, player)
+
+	for _, req := range []*webtools.RestRequest{
+		client.Post("/users").WithBodyString("2"),
+		client.Get("/users"),
+		client.Post("/users?page=2").WithBodyString("1"),
+	} {
+		_, err := req.Execute()
+
+		mismatch := errtools.CassetteMismatchError("")
+		if !errors.As(err, &mismatch) {
+			t.Errorf("Expected a cassette mismatch error, got %v", err)
+		}
+	}
+
+	if _, err := webtools.NewCassette(filepath.Join(t.TempDir(), "missing.json"), webtools.CassetteReplay); err == nil {
+		t.Error("Expected replaying a missing cassette to fail")
+	}
+}
+
+func TestCassetteReplayOrRecord(t *testing.T) {
+	calls := 0
+	srv := cassetteServer(&calls)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.yml")
+
+	for i := 0; i < 2; i++ {
+		cassette, err := webtools.NewCassette(path, webtools.CassetteReplayOrRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := webtools.NewRestClient(srv.URL, cassette)
+
+		for _, p := range []string{"/blob", "/blob", "/missing"} {
+			resp, err := client.Get(p).Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Close()
+		}
+	}
+
+	// The second request for /blob repeats the recorded interaction and the second run is
+	// served from the cassette
+	if calls != 2 {
+		t.Errorf("Expected 2 calls to the server, got %d", calls)
+	}
+}
+
+func TestCassetteWithClientCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert := webtools.WithClientCertificate(clientCertificate(t, "gofn-client"))
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+
+	// Given first, the certificate is set on the transport the cassette wraps
+	cassette, err := webtools.NewCassette(path, webtools.CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webtools.NewRestClient(srv.URL, &cert, cassette)
+
+	if transport, ok := cassette.Transport.(*http.Transport); !ok || len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Errorf("Expected the wrapped transport to have the certificate, got %T", cassette.Transport)
+	}
+
+	// Given after the cassette, the certificate is set on its transport, which trusts the test server
+	cassette, err = webtools.NewCassette(path, webtools.CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cassette.Transport = srv.Client().Transport.(*http.Transport).Clone()
+
+	resp, err := webtools.NewRestClient(srv.URL, cassette, &cert).Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := resp.BodyAsString(); body != "gofn-client" {
+		t.Errorf("Expected the server to see the client certificate, got %q", body)
+	}
+}
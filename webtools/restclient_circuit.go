@@ -0,0 +1,332 @@
+package webtools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+type CircuitState int
+
+const (
+	// Requests are sent and their outcome is recorded
+	CircuitClosed CircuitState = iota
+	// Requests fail with errtools.CircuitOpenError without being sent
+	CircuitOpen
+	// A limited number of trial requests decide whether the circuit closes or opens again
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+const circuitWindowBuckets = 10
+
+// CircuitBreaker keeps a circuit per host. The circuit opens when the share of failed requests in
+// the rolling window reaches FailureRatio, stays open for CoolDown and then lets trial requests
+// through. Install it with RestClient.WithCircuitBreaker or as middleware on a request
+type CircuitBreaker struct {
+	// Share of failed requests that opens the circuit, defaults to 0.5
+	FailureRatio float64
+
+	// Requests in the window before the ratio is evaluated, defaults to 10
+	MinRequests int
+
+	// Length of the rolling window, defaults to 30 seconds
+	Window time.Duration
+
+	// Time the circuit stays open before trial requests are sent, defaults to 30 seconds
+	CoolDown time.Duration
+
+	// Successful trial requests needed to close the circuit, defaults to 1
+	HalfOpenRequests int
+
+	// Decides whether an attempt failed, defaults to network errors, timeouts and 5xx responses
+	IsFailure func(resp *RestResponse, err error) bool
+
+	// Called after the circuit of a host changed state
+	OnStateChange func(host string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	openedAt time.Time
+	buckets  [circuitWindowBuckets]circuitBucket
+
+	// Trial requests in flight and succeeded while half-open
+	trials    int
+	successes int
+}
+
+type circuitBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+type circuitChange struct {
+	host     string
+	from, to CircuitState
+}
+
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{}
+}
+
+// Add a circuit breaker to the client, it runs as client middleware
+func (c *RestClient) WithCircuitBreaker(breaker *CircuitBreaker) *RestClient {
+	return c.WithMiddleware(breaker.Middleware())
+}
+
+func (cb *CircuitBreaker) Middleware() Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*RestResponse, error) {
+			host := req.URL.Host
+
+			if err := cb.allow(host, time.Now()); err != nil {
+				return nil, err
+			}
+
+			resp, err := next.Do(req)
+
+			// Requests canceled by the caller say nothing about the host
+			if errors.Is(err, context.Canceled) {
+				cb.release(host)
+				return resp, err
+			}
+
+			cb.record(host, !cb.isFailure(resp, err), time.Now())
+
+			return resp, err
+		})
+	}
+}
+
+// Current state of the circuit for a host as in url.URL.Host
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, ok := cb.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+
+	if c.state == CircuitOpen && !time.Now().Before(c.openedAt.Add(cb.coolDown())) {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+func (cb *CircuitBreaker) allow(host string, now time.Time) error {
+	var changes []circuitChange
+	defer func() { cb.notify(changes) }()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuit(host)
+
+	if c.state == CircuitOpen {
+		until := c.openedAt.Add(cb.coolDown())
+		if now.Before(until) {
+			return errtools.CircuitOpenError{Host: host, Until: until}
+		}
+
+		changes = append(changes, cb.transition(host, c, CircuitHalfOpen, now))
+	}
+
+	if c.state == CircuitHalfOpen {
+		if c.trials >= cb.halfOpenRequests() {
+			return errtools.CircuitOpenError{Host: host, Until: now.Add(cb.coolDown())}
+		}
+
+		c.trials++
+	}
+
+	return nil
+}
+
+func (cb *CircuitBreaker) record(host string, success bool, now time.Time) {
+	var changes []circuitChange
+	defer func() { cb.notify(changes) }()
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c := cb.circuit(host)
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if c.trials > 0 {
+			c.trials--
+		}
+
+		if !success {
+			changes = append(changes, cb.transition(host, c, CircuitOpen, now))
+			return
+		}
+
+		c.successes++
+		if c.successes >= cb.halfOpenRequests() {
+			changes = append(changes, cb.transition(host, c, CircuitClosed, now))
+		}
+	case CircuitClosed:
+		bucket := c.bucket(now, cb.window())
+		if success {
+			bucket.successes++
+		} else {
+			bucket.failures++
+		}
+
+		successes, failures := c.counts(now, cb.window())
+		total := successes + failures
+
+		if total >= cb.minRequests() && float64(failures)/float64(total) >= cb.failureRatio() {
+			changes = append(changes, cb.transition(host, c, CircuitOpen, now))
+		}
+	}
+}
+
+// Free the trial slot of a request that was not recorded
+func (cb *CircuitBreaker) release(host string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c := cb.circuit(host); c.state == CircuitHalfOpen && c.trials > 0 {
+		c.trials--
+	}
+}
+
+func (cb *CircuitBreaker) transition(host string, c *circuit, to CircuitState, now time.Time) circuitChange {
+	change := circuitChange{host: host, from: c.state, to: to}
+
+	c.state = to
+	c.trials = 0
+	c.successes = 0
+
+	switch to {
+	case CircuitOpen:
+		c.openedAt = now
+	case CircuitClosed:
+		c.buckets = [circuitWindowBuckets]circuitBucket{}
+	}
+
+	return change
+}
+
+func (cb *CircuitBreaker) notify(changes []circuitChange) {
+	if cb.OnStateChange == nil {
+		return
+	}
+
+	for _, change := range changes {
+		cb.OnStateChange(change.host, change.from, change.to)
+	}
+}
+
+func (cb *CircuitBreaker) circuit(host string) *circuit {
+	if cb.circuits == nil {
+		cb.circuits = map[string]*circuit{}
+	}
+
+	c, ok := cb.circuits[host]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[host] = c
+	}
+
+	return c
+}
+
+// The bucket for now, reset when it was last used in an earlier window
+func (c *circuit) bucket(now time.Time, window time.Duration) *circuitBucket {
+	size := window / circuitWindowBuckets
+	start := now.Truncate(size)
+	bucket := &c.buckets[(start.UnixNano()/int64(size))%circuitWindowBuckets]
+
+	if !bucket.start.Equal(start) {
+		*bucket = circuitBucket{start: start}
+	}
+
+	return bucket
+}
+
+func (c *circuit) counts(now time.Time, window time.Duration) (int, int) {
+	successes, failures := 0, 0
+
+	for _, bucket := range c.buckets {
+		if now.Sub(bucket.start) < window {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+
+	return successes, failures
+}
+
+func (cb *CircuitBreaker) isFailure(resp *RestResponse, err error) bool {
+	if cb.IsFailure != nil {
+		return cb.IsFailure(resp, err)
+	}
+
+	return err != nil || resp.StatusCode >= 500
+}
+
+func (cb *CircuitBreaker) failureRatio() float64 {
+	if cb.FailureRatio <= 0 {
+		return 0.5
+	}
+
+	return cb.FailureRatio
+}
+
+func (cb *CircuitBreaker) minRequests() int {
+	if cb.MinRequests <= 0 {
+		return 10
+	}
+
+	return cb.MinRequests
+}
+
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.Window < circuitWindowBuckets {
+		return 30 * time.Second
+	}
+
+	return cb.Window
+}
+
+func (cb *CircuitBreaker) coolDown() time.Duration {
+	if cb.CoolDown <= 0 {
+		return 30 * time.Second
+	}
+
+	return cb.CoolDown
+}
+
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.HalfOpenRequests <= 0 {
+		return 1
+	}
+
+	return cb.HalfOpenRequests
+}
@@ -0,0 +1,133 @@
+package webtools_test
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+	"github.com/scheiblingco/gofn/webtools/webtest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// Four requests open the circuit and the first trial fails, the second trial succeeds
+	srv := webtest.NewServer(t)
+	failing := srv.Expect(webtools.GET, "/").Respond(http.StatusBadGateway, "").Times(5)
+	srv.Expect(webtools.GET, "/").Times(3)
+
+	healthy := webtest.NewServer(t)
+	healthy.Expect(webtools.GET, "/")
+
+	mu := sync.Mutex{}
+	changes := []string{}
+
+	breaker := &webtools.CircuitBreaker{
+		MinRequests: 4,
+		CoolDown:    100 * time.Millisecond,
+		OnStateChange: func(host string, from, to webtools.CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	}
+
+	client := webtools.NewRestClient(srv.URL).WithCircuitBreaker(breaker)
+
+	send := func(url string) error {
+		resp, err := client.Get(url).Execute()
+		if err == nil {
+			resp.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := send("/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	openErr := errtools.CircuitOpenError{}
+	if err := send("/"); !errors.As(err, &openErr) || failing.Calls() != 4 {
+		t.Fatalf("Expected the open circuit to fail fast, got %v after %d calls", err, failing.Calls())
+	}
+
+	if breaker.State(openErr.Host) != webtools.CircuitOpen {
+		t.Errorf("Expected the circuit to be open, got %s", breaker.State(openErr.Host))
+	}
+
+	// Other hosts have their own circuit
+	if err := send(healthy.URL); err != nil {
+		t.Errorf("Expected a healthy host to be reachable, got %v", err)
+	}
+
+	// A failed trial opens the circuit again
+	time.Sleep(120 * time.Millisecond)
+
+	if err := send("/"); err != nil || failing.Calls() != 5 {
+		t.Fatalf("Expected a trial request after the cool down, got %v", err)
+	}
+
+	if err := send("/"); !errors.As(err, &openErr) {
+		t.Errorf("Expected the circuit to open after a failed trial, got %v", err)
+	}
+
+	// A successful trial closes it
+	time.Sleep(120 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if err := send("/"); err != nil {
+			t.Fatalf("Expected the circuit to close, got %v", err)
+		}
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !slices.Equal(changes, expected) {
+		t.Errorf("Expected state changes %v, got %v", expected, changes)
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	// Every third request fails, below the default ratio of one half
+	srv := webtest.NewServer(t)
+	expectation := srv.Expect(webtools.GET, "/").Times(31)
+
+	for i := 1; i <= 31; i++ {
+		if i%3 == 0 {
+			expectation.Respond(http.StatusInternalServerError, "")
+		} else {
+			expectation.Respond(http.StatusOK, "")
+		}
+	}
+
+	breaker := webtools.NewCircuitBreaker()
+	client := webtools.NewRestClient(srv.URL).WithCircuitBreaker(breaker)
+
+	for i := 0; i < 30; i++ {
+		resp, err := client.Get("/").Execute()
+		if err != nil {
+			t.Fatalf("Expected the circuit to stay closed, got %v", err)
+		}
+		resp.Close()
+	}
+
+	breaker.FailureRatio = 0.3
+
+	resp, err := client.Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if _, err := client.Get("/").Execute(); !errors.As(err, &errtools.CircuitOpenError{}) {
+		t.Errorf("Expected the circuit to open at the lower ratio, got %v", err)
+	}
+}
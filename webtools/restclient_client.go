@@ -0,0 +1,151 @@
+package webtools
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RestClient holds the shared settings for requests against a single service,
+// requests created from it are executed through its http.Client
+type RestClient struct {
+	BaseUrl       string
+	Headers       map[string]string
+	Header        http.Header
+	Authorization Authorization
+	HttpClient    *http.Client
+	Retrier       Retrier
+	Middleware    []Middleware
+}
+
+// Create a new RestClient for the base url, the http.Client is built with GetHttpClient
+func NewRestClient(baseUrl string, opts ...ClientOpts) *RestClient {
+	return &RestClient{
+		BaseUrl:    baseUrl,
+		HttpClient: GetHttpClient(opts...),
+	}
+}
+
+func (c *RestClient) WithHeader(key, value string) *RestClient {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+
+	c.Headers[key] = value
+
+	return c
+}
+
+// Add a default header value, keeping existing values
+func (c *RestClient) AddHeader(key, value string) *RestClient {
+	if c.Header == nil {
+		c.Header = http.Header{}
+	}
+
+	c.Header.Add(key, value)
+
+	return c
+}
+
+func (c *RestClient) WithHeaders(headers map[string]string) *RestClient {
+	for k, v := range headers {
+		c = c.WithHeader(k, v)
+	}
+
+	return c
+}
+
+func (c *RestClient) WithAuthorization(auth Authorization) *RestClient {
+	c.Authorization = auth
+	return c
+}
+
+func (c *RestClient) WithRetry(retrier Retrier) *RestClient {
+	c.Retrier = retrier
+	return c
+}
+
+// Add middleware to the client, client middleware runs before middleware added to a request
+func (c *RestClient) WithMiddleware(middleware ...Middleware) *RestClient {
+	c.Middleware = append(c.Middleware, middleware...)
+	return c
+}
+
+func (c *RestClient) WithHttpClient(client *http.Client) *RestClient {
+	c.HttpClient = client
+	return c
+}
+
+// Create a request for the path relative to the base url, absolute urls are used as-is
+func (c *RestClient) NewRequest(method RequestMethod, path string) *RestRequest {
+	req := NewRequest(method, c.resolveUrl(path))
+	req.client = c
+
+	if len(c.Headers) > 0 {
+		req = req.WithHeaders(c.Headers)
+	}
+
+	for k, values := range c.Header {
+		for _, v := range values {
+			req = req.AddHeader(k, v)
+		}
+	}
+
+	if c.Authorization != nil {
+		req = req.WithAuthorization(c.Authorization)
+	}
+
+	if c.Retrier != nil {
+		req = req.WithRetry(c.Retrier)
+	}
+
+	if len(c.Middleware) > 0 {
+		req = req.WithMiddleware(c.Middleware...)
+	}
+
+	return req
+}
+
+func (c *RestClient) Get(path string) *RestRequest {
+	return c.NewRequest(GET, path)
+}
+
+func (c *RestClient) Post(path string) *RestRequest {
+	return c.NewRequest(POST, path)
+}
+
+func (c *RestClient) Put(path string) *RestRequest {
+	return c.NewRequest(PUT, path)
+}
+
+func (c *RestClient) Delete(path string) *RestRequest {
+	return c.NewRequest(DELETE, path)
+}
+
+func (c *RestClient) Patch(path string) *RestRequest {
+	return c.NewRequest(PATCH, path)
+}
+
+func (c *RestClient) httpClient() *http.Client {
+	if c == nil || c.HttpClient == nil {
+		return http.DefaultClient
+	}
+
+	return c.HttpClient
+}
+
+func (c *RestClient) resolveUrl(path string) string {
+	// Only a scheme before the query makes the path absolute, the query may contain urls
+	if prefix, _ := splitUrlPath(path); c.BaseUrl == "" || strings.Contains(prefix, "://") {
+		return path
+	}
+
+	if path == "" {
+		return c.BaseUrl
+	}
+
+	if strings.HasPrefix(path, "?") {
+		return strings.TrimRight(c.BaseUrl, "/") + path
+	}
+
+	return strings.TrimRight(c.BaseUrl, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,84 @@
+package webtools_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+type countingTransport struct {
+	count int
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ct.count++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/users" {
+			t.Errorf("Expected path /api/users, got %s", r.URL.Path)
+		}
+
+		if r.Header.Get("X-Default") != "default" {
+			t.Errorf("Expected default header, got %q", r.Header.Get("X-Default"))
+		}
+
+		if r.Header.Get("X-Override") != "request" {
+			t.Errorf("Expected overridden header, got %q", r.Header.Get("X-Override"))
+		}
+
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			t.Errorf("Expected basic auth user:pass, got %s:%s", user, pass)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+
+	client := webtools.NewRestClient(srv.URL + "/api/").
+		WithHttpClient(&http.Client{Transport: transport}).
+		WithHeaders(map[string]string{
+			"X-Default":  "default",
+			"X-Override": "client",
+		}).
+		WithAuthorization(&webtools.BasicAuth{Username: "user", Password: "pass"})
+
+	resp, err := client.Get("/users").WithHeader("X-Override", "request").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status code 204, got %d", resp.StatusCode)
+	}
+
+	if transport.count != 1 {
+		t.Errorf("Expected the client transport to be used once, got %d", transport.count)
+	}
+}
+
+func TestRestClientResolveUrl(t *testing.T) {
+	client := webtools.NewRestClient("https://example.com/api/")
+
+	tests := map[string]string{
+		"/users":                                 "https://example.com/api/users",
+		"":                                       "https://example.com/api/",
+		"?page=2":                                "https://example.com/api?page=2",
+		"https://other.example/x":                "https://other.example/x",
+		"/login?next=https://other.example/x":    "https://example.com/api/login?next=https://other.example/x",
+		"/docs#see-https://other.example/anchor": "https://example.com/api/docs#see-https://other.example/anchor",
+	}
+
+	for path, expected := range tests {
+		if url := client.Get(path).Url; url != expected {
+			t.Errorf("%q: expected %s, got %s", path, expected, url)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package webtools
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+type CompressionAlgorithm string
+
+const (
+	CompressionGzip CompressionAlgorithm = "gzip"
+	// Deflate is the zlib format as specified for the deflate content coding
+	CompressionDeflate CompressionAlgorithm = "deflate"
+	CompressionZstd    CompressionAlgorithm = "zstd"
+)
+
+// Compress the request body with the algorithm and set the Content-Encoding header. Applies to
+// a body set before or after this call, bodies set from a reader or streamed cannot be compressed
+func (r *RestRequest) WithCompressedBody(algorithm CompressionAlgorithm) *RestRequest {
+	switch algorithm {
+	case CompressionGzip, CompressionDeflate, CompressionZstd:
+	default:
+		r.addError(errtools.InvalidFieldError("unsupported compression algorithm " + string(algorithm)))
+		return r
+	}
+
+	if r.compression != "" {
+		r.addError(errtools.InvalidFieldError("body compression is already set to " + string(r.compression)))
+		return r
+	}
+
+	if !r.replayable() {
+		r.addError(errtools.BodyNotAcceptedError("a body set from a reader cannot be compressed"))
+		return r
+	}
+
+	r.compression = algorithm
+
+	if r.body != nil {
+		r.setBody(r.body)
+	}
+
+	return r
+}
+
+func compressBody(algorithm CompressionAlgorithm, body []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	var err error
+
+	switch algorithm {
+	case CompressionGzip:
+		w = gzip.NewWriter(buf)
+	case CompressionDeflate:
+		w = zlib.NewWriter(buf)
+	case CompressionZstd:
+		w, err = zstd.NewWriter(buf)
+	default:
+		err = errtools.InvalidFieldError("unsupported compression algorithm " + string(algorithm))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Wrap the body in decoders for the codings in the Content-Encoding header, codings are
+// removed in the reverse order they were applied. The transport already removes the header
+// when it decompressed the body itself. Decoding stops at a coding that is not supported and
+// the body is returned as it is from there, an empty body is returned as empty
+func decompressReader(contentEncoding []string, body io.Reader) (io.Reader, []io.Closer, error) {
+	codings := []string{}
+	for _, value := range contentEncoding {
+		for _, coding := range strings.Split(value, ",") {
+			if coding = strings.ToLower(strings.TrimSpace(coding)); coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+
+	closers := []io.Closer{}
+
+	if len(codings) == 0 {
+		return body, closers, nil
+	}
+
+	// Responses without content, like 204 or HEAD, may still name a coding
+	buffered := bufio.NewReader(body)
+	if _, err := buffered.Peek(1); err == io.EOF {
+		return buffered, closers, nil
+	}
+	body = buffered
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, closers, err
+			}
+			body = gz
+			closers = append(closers, gz)
+		case "deflate":
+			zr, err := zlib.NewReader(body)
+			if err != nil {
+				return nil, closers, err
+			}
+			body = zr
+			closers = append(closers, zr)
+		case "zstd":
+			zr, err := zstd.NewReader(body)
+			if err != nil {
+				return nil, closers, err
+			}
+			body = zr
+			closers = append(closers, zr.IOReadCloser())
+		default:
+			return body, closers, nil
+		}
+	}
+
+	return body, closers, nil
+}
+
+// Read up to limit bytes of the decompressed body, or all of it when limit is negative, and close it
+func (r *RestResponse) readBody(limit int64) ([]byte, error) {
+	defer r.discard()
+
+	body, closers, err := decompressReader(r.Response.Header.Values("Content-Encoding"), r.Response.Body)
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if limit >= 0 {
+		body = io.LimitReader(body, limit)
+	}
+
+	return io.ReadAll(body)
+}
@@ -0,0 +1,262 @@
+package webtools_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func decompress(t *testing.T, encoding string, body io.Reader) []byte {
+	var r io.Reader
+	var err error
+
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(body)
+	case "deflate":
+		r, err = zlib.NewReader(body)
+	case "zstd":
+		r, err = zstd.NewReader(body)
+	default:
+		r = body
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	buf := &bytes.Buffer{}
+
+	var w io.WriteCloser
+	var err error
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "zstd":
+		w, err = zstd.NewWriter(buf)
+	default:
+		return data
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Write(data)
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func TestCompressedRequestBody(t *testing.T) {
+	for _, algorithm := range []webtools.CompressionAlgorithm{webtools.CompressionGzip, webtools.CompressionDeflate, webtools.CompressionZstd} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			calls := 0
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+
+				if r.Header.Get("Content-Encoding") != string(algorithm) {
+					t.Errorf("Expected content encoding %s, got %q", algorithm, r.Header.Get("Content-Encoding"))
+				}
+
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("Expected json content type, got %q", r.Header.Get("Content-Type"))
+				}
+
+				if body := decompress(t, string(algorithm), r.Body); string(body) != `{"event":"login"}` {
+					t.Errorf("Unexpected body %s", body)
+				}
+
+				if calls == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			// Compression applies both to bodies set before and after the call, and the body is replayed on retry
+			reqs := []*webtools.RestRequest{
+				webtools.PostRequest(srv.URL).WithJsonBody(map[string]string{"event": "login"}, nil).WithCompressedBody(algorithm),
+				webtools.PostRequest(srv.URL).WithCompressedBody(algorithm).WithJsonBody(map[string]string{"event": "login"}, nil),
+			}
+
+			for _, req := range reqs {
+				calls = 0
+
+				resp, err := req.WithRetry(&webtools.RetryPolicy{MaxAttempts: 2, RetryStatusCodes: []int{http.StatusServiceUnavailable}, RetryMethods: []webtools.RequestMethod{webtools.POST}}).Execute()
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Close()
+
+				if resp.StatusCode != http.StatusOK || calls != 2 {
+					t.Errorf("Expected the retried request to succeed, got status %d after %d calls", resp.StatusCode, calls)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedBodyErrors(t *testing.T) {
+	if err := webtools.PostRequest("http://localhost").WithCompressedBody("br").Validate(); err == nil {
+		t.Error("Expected unsupported algorithm to fail")
+	}
+
+	if err := webtools.PostRequest("http://localhost").WithCompressedBody(webtools.CompressionGzip).WithCompressedBody(webtools.CompressionZstd).Validate(); err == nil {
+		t.Error("Expected compressing twice to fail")
+	}
+
+	req := webtools.PostRequest("http://localhost")
+	req.BodyReader = bytes.NewReader([]byte("stream"))
+
+	if err := req.WithCompressedBody(webtools.CompressionGzip).Validate(); err == nil {
+		t.Error("Expected a reader body not to be compressed")
+	}
+
+	fields := []webtools.MultipartField{*webtools.NewMultipartField("name").WithStringValue("gofn")}
+
+	if err := webtools.PostRequest("http://localhost").WithCompressedBody(webtools.CompressionGzip).WithStreamingMultipartFormBody(fields, nil).Validate(); err == nil {
+		t.Error("Expected a streamed body not to be compressed")
+	}
+}
+
+func TestDecompressedResponseBody(t *testing.T) {
+	payload, _ := json.Marshal(map[string]string{"name": "gofn"})
+
+	for _, encoding := range []string{"gzip", "deflate", "zstd", "identity"} {
+		t.Run(encoding, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", encoding)
+				w.Write(compress(t, encoding, payload))
+			}))
+			defer srv.Close()
+
+			// Setting Accept-Encoding disables the transparent gzip handling of the transport
+			req := func() *webtools.RestRequest {
+				return webtools.GetRequest(srv.URL).WithHeader("Accept-Encoding", "gzip, deflate, zstd")
+			}
+
+			resp, err := req().Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, err := resp.BodyAsString()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if body != string(payload) {
+				t.Errorf("Expected decompressed body, got %q", body)
+			}
+
+			resp, err = req().Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := map[string]string{}
+			if err := resp.UnmarshalJsonBody(&result); err != nil {
+				t.Fatal(err)
+			}
+
+			if result["name"] != "gofn" {
+				t.Errorf("Unexpected result %v", result)
+			}
+
+			typed, err := webtools.Do[map[string]string](req())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if typed["name"] != "gofn" {
+				t.Errorf("Unexpected result %v", typed)
+			}
+		})
+	}
+}
+
+func TestDecompressedErrorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(compress(t, "gzip", []byte("invalid input")))
+	}))
+	defer srv.Close()
+
+	resp, err := webtools.GetRequest(srv.URL).WithHeader("Accept-Encoding", "gzip").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statusErr := errtools.HTTPStatusError{}
+	if !errors.As(resp.StatusError(), &statusErr) || string(statusErr.Body) != "invalid input" {
+		t.Errorf("Expected decompressed error body, got %v", statusErr)
+	}
+}
+
+func TestUndecodedResponseBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusNoContent)
+		case "/empty-error":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusBadRequest)
+		case "/brotli":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte("raw bytes"))
+		}
+	}))
+	defer srv.Close()
+
+	// Setting Accept-Encoding disables the transparent gzip handling of the transport
+	get := func(path string) *webtools.RestResponse {
+		resp, err := webtools.GetRequest(srv.URL+path).WithHeader("Accept-Encoding", "gzip, br").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return resp
+	}
+
+	if body, err := get("/empty").BodyAsBytes(); err != nil || len(body) != 0 {
+		t.Errorf("Expected an empty body, got %q (%v)", body, err)
+	}
+
+	statusErr := errtools.HTTPStatusError{}
+	if err := get("/empty-error").StatusError(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || len(statusErr.Body) != 0 {
+		t.Errorf("Expected a status error with an empty body, got %v", err)
+	}
+
+	if body, err := get("/brotli").BodyAsString(); err != nil || body != "raw bytes" {
+		t.Errorf("Expected the raw body for an unsupported coding, got %q (%v)", body, err)
+	}
+}
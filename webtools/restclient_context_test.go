@@ -0,0 +1,68 @@
+package webtools_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func slowServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestRequestTimeout(t *testing.T) {
+	srv := slowServer(time.Second)
+	defer srv.Close()
+
+	_, err := webtools.GetRequest(srv.URL).WithTimeout(20 * time.Millisecond).Execute()
+
+	var timeoutErr errtools.RequestTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected RequestTimeoutError, got %v", err)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRequestCanceled(t *testing.T) {
+	srv := slowServer(time.Second)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := webtools.GetRequest(srv.URL).ExecuteContext(ctx)
+
+	var cancelErr errtools.RequestCanceledError
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("Expected RequestCanceledError, got %v", err)
+	}
+}
+
+func TestRequestTimeoutNotExceeded(t *testing.T) {
+	srv := slowServer(0)
+	defer srv.Close()
+
+	resp, err := webtools.GetRequest(srv.URL).WithContext(context.Background()).WithTimeout(time.Second).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resp.BodyAsBytes(); err != nil {
+		t.Errorf("Expected body to be readable after execute, got %v", err)
+	}
+}
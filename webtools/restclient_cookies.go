@@ -0,0 +1,432 @@
+package webtools
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+type CookieFormat string
+
+const (
+	CookieFormatJSON CookieFormat = "json"
+	// The cookies.txt format used by curl, wget and browser extensions
+	CookieFormatNetscape CookieFormat = "netscape"
+)
+
+// CookieSession is a cookie jar that can be saved to and restored from a file, so a
+// session established with a login request survives a restart of the process. Session
+// cookies without an expiry are saved as well. Use it with WithCookieJar
+type CookieSession struct {
+	// File the cookies are saved to and loaded from
+	Path string
+
+	// Defaults to netscape for files ending in .txt and json otherwise
+	Format CookieFormat
+
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	cookies map[string]*sessionCookie
+}
+
+type sessionCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	HostOnly bool   `json:"host_only"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"http_only"`
+
+	// Unix time the cookie expires, zero for session cookies
+	Expires int64 `json:"expires,omitempty"`
+}
+
+// Create a session backed by the file at path, cookies already saved in the file are loaded
+func NewCookieSession(path string, format CookieFormat) (*CookieSession, error) {
+	session := &CookieSession{
+		Path:   path,
+		Format: format,
+	}
+
+	if err := session.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *CookieSession) Cookies(u *url.URL) []*http.Cookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+
+	return s.jar.Cookies(u)
+}
+
+func (s *CookieSession) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.init()
+	s.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+
+	for _, cookie := range cookies {
+		sc, ok := newSessionCookie(u, cookie, now)
+		if !ok {
+			continue
+		}
+
+		if sc.Expires != 0 && sc.Expires <= now.Unix() {
+			delete(s.cookies, sc.key())
+			continue
+		}
+
+		s.cookies[sc.key()] = sc
+	}
+}
+
+// Remove all cookies from the session, the file is not changed until Save is called
+func (s *CookieSession) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jar = nil
+	s.cookies = nil
+	s.init()
+}
+
+// Write the cookies that have not expired to the file
+func (s *CookieSession) Save() error {
+	if s.Path == "" {
+		return errtools.MissingValueError("cookie session path")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := s.Write(tmp, s.format()); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// Replace the cookies in the session with those saved in the file
+func (s *CookieSession) Load() error {
+	if s.Path == "" {
+		return errtools.MissingValueError("cookie session path")
+	}
+
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return s.Read(file, s.format())
+}
+
+// Write the cookies that have not expired in the format
+func (s *CookieSession) Write(w io.Writer, format CookieFormat) error {
+	cookies := s.snapshot()
+
+	switch format {
+	case CookieFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cookies)
+	case CookieFormatNetscape:
+		return writeNetscapeCookies(w, cookies)
+	}
+
+	return errtools.InvalidFieldError("unsupported cookie format " + string(format))
+}
+
+// Replace the cookies in the session with those read in the format, expired cookies are skipped
+func (s *CookieSession) Read(r io.Reader, format CookieFormat) error {
+	var cookies []*sessionCookie
+	var err error
+
+	switch format {
+	case CookieFormatJSON:
+		err = json.NewDecoder(r).Decode(&cookies)
+	case CookieFormatNetscape:
+		cookies, err = readNetscapeCookies(r)
+	default:
+		err = errtools.InvalidFieldError("unsupported cookie format " + string(format))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jar = nil
+	s.cookies = nil
+	s.init()
+
+	now := time.Now().Unix()
+
+	for _, sc := range cookies {
+		if sc.Name == "" || sc.Domain == "" || (sc.Expires != 0 && sc.Expires <= now) {
+			continue
+		}
+
+		u, cookie := sc.httpCookie()
+		s.jar.SetCookies(u, []*http.Cookie{cookie})
+		s.cookies[sc.key()] = sc
+	}
+
+	return nil
+}
+
+func (s *CookieSession) init() {
+	if s.jar == nil {
+		s.jar, _ = cookiejar.New(nil)
+	}
+
+	if s.cookies == nil {
+		s.cookies = map[string]*sessionCookie{}
+	}
+}
+
+// Cookies that have not expired, sorted so saved files are stable
+func (s *CookieSession) snapshot() []*sessionCookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	cookies := []*sessionCookie{}
+
+	for key, sc := range s.cookies {
+		if sc.Expires != 0 && sc.Expires <= now {
+			delete(s.cookies, key)
+			continue
+		}
+
+		cookies = append(cookies, sc)
+	}
+
+	sort.Slice(cookies, func(i, j int) bool {
+		return cookies[i].key() < cookies[j].key()
+	})
+
+	return cookies
+}
+
+func (s *CookieSession) format() CookieFormat {
+	if s.Format != "" {
+		return s.Format
+	}
+
+	if strings.EqualFold(filepath.Ext(s.Path), ".txt") {
+		return CookieFormatNetscape
+	}
+
+	return CookieFormatJSON
+}
+
+// Resolve the domain, path and expiry of a cookie received from u the way the jar does
+func newSessionCookie(u *url.URL, cookie *http.Cookie, now time.Time) (*sessionCookie, bool) {
+	host := strings.ToLower(u.Hostname())
+
+	sc := &sessionCookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   host,
+		Path:     cookie.Path,
+		HostOnly: true,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+	}
+
+	if domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, ".")); domain != "" && domain != host {
+		if net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+domain) {
+			return nil, false
+		}
+
+		sc.Domain = domain
+		sc.HostOnly = false
+	} else if domain != "" && net.ParseIP(host) == nil {
+		sc.HostOnly = false
+	}
+
+	if sc.Path == "" || !strings.HasPrefix(sc.Path, "/") {
+		sc.Path = defaultCookiePath(u.Path)
+	}
+
+	switch {
+	case cookie.MaxAge < 0:
+		sc.Expires = now.Unix() - 1
+	case cookie.MaxAge > 0:
+		sc.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+	case !cookie.Expires.IsZero():
+		sc.Expires = cookie.Expires.Unix()
+		if sc.Expires <= now.Unix() {
+			sc.Expires = now.Unix() - 1
+		}
+	}
+
+	return sc, true
+}
+
+// Directory of the request path as defined in RFC 6265 section 5.1.4
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+
+	return path[:i]
+}
+
+func (sc *sessionCookie) key() string {
+	return sc.Domain + ";" + sc.Path + ";" + sc.Name
+}
+
+// The cookie and an url it can be set from to restore it into a jar
+func (sc *sessionCookie) httpCookie() (*url.URL, *http.Cookie) {
+	scheme := "http"
+	if sc.Secure {
+		scheme = "https"
+	}
+
+	cookie := &http.Cookie{
+		Name:     sc.Name,
+		Value:    sc.Value,
+		Path:     sc.Path,
+		Secure:   sc.Secure,
+		HttpOnly: sc.HttpOnly,
+	}
+
+	if !sc.HostOnly {
+		cookie.Domain = sc.Domain
+	}
+
+	if sc.Expires != 0 {
+		cookie.Expires = time.Unix(sc.Expires, 0)
+	}
+
+	return &url.URL{Scheme: scheme, Host: sc.Domain, Path: sc.Path}, cookie
+}
+
+const netscapeHttpOnlyPrefix = "#HttpOnly_"
+
+func writeNetscapeCookies(w io.Writer, cookies []*sessionCookie) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Netscape HTTP Cookie File\n\n")
+
+	for _, sc := range cookies {
+		domain := sc.Domain
+		if !sc.HostOnly {
+			domain = "." + domain
+		}
+
+		if sc.HttpOnly {
+			domain = netscapeHttpOnlyPrefix + domain
+		}
+
+		fields := []string{
+			domain,
+			netscapeBool(!sc.HostOnly),
+			sc.Path,
+			netscapeBool(sc.Secure),
+			strconv.FormatInt(sc.Expires, 10),
+			sc.Name,
+			sc.Value,
+		}
+
+		bw.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+
+	return bw.Flush()
+}
+
+func readNetscapeCookies(r io.Reader) ([]*sessionCookie, error) {
+	cookies := []*sessionCookie{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		httpOnly := false
+		if strings.HasPrefix(text, netscapeHttpOnlyPrefix) {
+			httpOnly = true
+			text = strings.TrimPrefix(text, netscapeHttpOnlyPrefix)
+		}
+
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) == 6 {
+			// A cookie without a value
+			fields = append(fields, "")
+		}
+
+		if len(fields) != 7 {
+			return nil, errtools.InvalidFieldError("invalid cookie on line " + strconv.Itoa(line))
+		}
+
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, errtools.InvalidFieldError("invalid cookie expiry on line " + strconv.Itoa(line))
+		}
+
+		cookies = append(cookies, &sessionCookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			Path:     fields[2],
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Expires:  expires,
+		})
+	}
+
+	return cookies, scanner.Err()
+}
+
+func netscapeBool(v bool) string {
+	if v {
+		return "TRUE"
+	}
+
+	return "FALSE"
+}
@@ -0,0 +1,167 @@
+package webtools_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func sessionServer(t *testing.T, logins *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			*logins++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/", HttpOnly: true})
+			http.SetCookie(w, &http.Cookie{Name: "pref", Value: "dark", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "tracking", Value: "1", Path: "/", MaxAge: 3600})
+		case "/logout-tracking":
+			http.SetCookie(w, &http.Cookie{Name: "tracking", Path: "/", MaxAge: -1})
+		case "/portal":
+			cookie, err := r.Cookie("session")
+			if err != nil || cookie.Value != "s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if _, err := r.Cookie("tracking"); err == nil {
+				t.Error("Expected the deleted cookie not to be sent")
+			}
+		}
+	}))
+}
+
+func TestCookieJarClientOpt(t *testing.T) {
+	logins := 0
+	srv := sessionServer(t, &logins)
+	defer srv.Close()
+
+	client := webtools.NewRestClient(srv.URL, &webtools.WithCookieJar{})
+
+	for _, path := range []string{"/login", "/logout-tracking", "/portal"} {
+		resp, err := client.Get(path).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s to succeed, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestCookieSessionPersistence(t *testing.T) {
+	for _, name := range []string{"cookies.json", "cookies.txt"} {
+		t.Run(name, func(t *testing.T) {
+			logins := 0
+			srv := sessionServer(t, &logins)
+			defer srv.Close()
+
+			path := filepath.Join(t.TempDir(), name)
+
+			session, err := webtools.NewCookieSession(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := webtools.NewRestClient(srv.URL, &webtools.WithCookieJar{Jar: session})
+
+			for _, p := range []string{"/login", "/logout-tracking"} {
+				resp, err := client.Get(p).Execute()
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Close()
+			}
+
+			if err := session.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(data), "tracking") {
+				t.Errorf("Expected the deleted cookie not to be saved, got %s", data)
+			}
+
+			if name == "cookies.txt" && !strings.HasPrefix(string(data), "# Netscape HTTP Cookie File") {
+				t.Errorf("Expected a netscape cookie file, got %s", data)
+			}
+
+			// A new process restores the session from the file without logging in again
+			restored, err := webtools.NewCookieSession(path, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := webtools.NewRestClient(srv.URL, &webtools.WithCookieJar{Jar: restored}).Get("/portal").Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Close()
+
+			if resp.StatusCode != http.StatusOK || logins != 1 {
+				t.Errorf("Expected the restored session to be accepted, got %d after %d logins", resp.StatusCode, logins)
+			}
+		})
+	}
+}
+
+func TestCookieSessionNetscapeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies")
+
+	content := strings.Join([]string{
+		"# Netscape HTTP Cookie File",
+		"",
+		".example.com\tTRUE\t/\tTRUE\t0\tsid\tabc",
+		"#HttpOnly_api.example.com\tFALSE\t/v1\tFALSE\t4102444800\ttoken\txyz",
+		"old.example.com\tFALSE\t/\tFALSE\t1\texpired\tgone",
+	}, "\n")
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := webtools.NewCookieSession(path, webtools.CookieFormatNetscape)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"https://www.example.com/":    {"sid=abc"},
+		"http://www.example.com/":     {},
+		"https://api.example.com/v1/": {"token=xyz", "sid=abc"},
+		"https://api.example.com/v2/": {"sid=abc"},
+		"http://old.example.com/":     {},
+	}
+
+	for rawUrl, expected := range tests {
+		u, _ := url.Parse(rawUrl)
+
+		got := []string{}
+		for _, cookie := range session.Cookies(u) {
+			got = append(got, cookie.String())
+		}
+
+		if strings.Join(got, ";") != strings.Join(expected, ";") {
+			t.Errorf("Expected cookies %v for %s, got %v", expected, rawUrl, got)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("invalid line"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := webtools.NewCookieSession(path, webtools.CookieFormatNetscape); err == nil {
+		t.Error("Expected an invalid cookie file to fail")
+	}
+}
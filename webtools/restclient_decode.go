@@ -0,0 +1,154 @@
+package webtools
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// Maximum number of body bytes kept in an HTTPStatusError
+var MaxErrorBodySize = 4096
+
+// Execute the request and decode a 2xx response into T, any other status returns an errtools.HTTPStatusError
+func Do[T any](req *RestRequest) (T, error) {
+	var result T
+
+	resp, err := req.Execute()
+	if err != nil {
+		return result, err
+	}
+	defer resp.Close()
+
+	if !resp.IsSuccess() {
+		return result, resp.StatusError()
+	}
+
+	return result, resp.decodeInto(&result)
+}
+
+// Execute the request and decode a 2xx response into T. Error responses (4xx and 5xx) are decoded
+// into E and returned as an errtools.APIError that also carries the errtools.HTTPStatusError, when
+// the body does not decode into a non-zero E only the HTTPStatusError is returned
+func ExecuteInto[T any, E error](req *RestRequest) (T, error) {
+	var result T
+
+	resp, err := req.Execute()
+	if err != nil {
+		return result, err
+	}
+	defer resp.Close()
+
+	if resp.IsSuccess() {
+		return result, resp.decodeInto(&result)
+	}
+
+	body, err := resp.BodyAsBytes()
+	if err != nil {
+		return result, err
+	}
+
+	statusErr := resp.statusError(body)
+
+	if resp.StatusCode >= 400 && len(body) > 0 {
+		var apiErr E
+		if err := resp.unmarshal(body, &apiErr); err == nil && !isZeroValue(reflect.ValueOf(&apiErr).Elem()) {
+			return result, errtools.APIError{Err: apiErr, Status: statusErr}
+		}
+	}
+
+	return result, statusErr
+}
+
+// Nil pointers and pointers to zero values count as zero
+func isZeroValue(rv reflect.Value) bool {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return true
+		}
+
+		rv = rv.Elem()
+	}
+
+	return rv.IsZero()
+}
+
+func (r *RestResponse) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode <= 299
+}
+
+// Returns nil for 2xx responses, otherwise reads the body into an errtools.HTTPStatusError
+func (r *RestResponse) StatusError() error {
+	if r.IsSuccess() {
+		return nil
+	}
+
+	body := []byte{}
+	if !r.bodyRead {
+		r.bodyRead = true
+		body, _ = r.readBody(int64(MaxErrorBodySize))
+	}
+
+	return r.statusError(body)
+}
+
+func (r *RestResponse) statusError(body []byte) errtools.HTTPStatusError {
+	if len(body) > MaxErrorBodySize {
+		body = body[:MaxErrorBodySize]
+	}
+
+	statusErr := errtools.HTTPStatusError{
+		StatusCode: r.StatusCode,
+		Status:     r.Response.Status,
+		Headers:    r.Headers,
+		Body:       body,
+	}
+
+	if statusErr.Status == "" {
+		statusErr.Status = strconv.Itoa(r.StatusCode) + " " + http.StatusText(r.StatusCode)
+	}
+
+	if r.Response.Request != nil {
+		statusErr.Url = redactedUrl(r.Response.Request).String()
+	}
+
+	return statusErr
+}
+
+func (r *RestResponse) decodeInto(v interface{}) error {
+	body, err := r.BodyAsBytes()
+	if err != nil {
+		return err
+	}
+
+	switch target := v.(type) {
+	case *[]byte:
+		*target = body
+		return nil
+	case *string:
+		*target = string(body)
+		return nil
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	return r.unmarshal(body, v)
+}
+
+// Unmarshal xml content types as xml and everything else as json
+func (r *RestResponse) unmarshal(body []byte, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(http.Header(r.Headers).Get("Content-Type"))
+
+	if strings.HasSuffix(mediaType, "xml") {
+		return xml.Unmarshal(body, v)
+	}
+
+	return json.Unmarshal(body, v)
+}
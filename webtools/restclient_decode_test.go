@@ -0,0 +1,117 @@
+package webtools_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+type decodeUser struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type decodeApiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *decodeApiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+type decodeValueError struct {
+	Code string `json:"code"`
+}
+
+func (e decodeValueError) Error() string {
+	return e.Code
+}
+
+func decodeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(decodeUser{Id: 1, Name: "alice"})
+		case "/users/2":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(decodeApiError{Code: "not_found", Message: "user 2 does not exist"})
+		case "/mismatch":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"x"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(strings.Repeat("x", webtools.MaxErrorBodySize+100)))
+		}
+	}))
+}
+
+func TestDo(t *testing.T) {
+	srv := decodeServer()
+	defer srv.Close()
+
+	user, err := webtools.Do[decodeUser](webtools.GetRequest(srv.URL + "/users/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Id != 1 || user.Name != "alice" {
+		t.Errorf("Expected user 1 alice, got %+v", user)
+	}
+
+	_, err = webtools.Do[decodeUser](webtools.GetRequest(srv.URL + "/fail"))
+
+	var statusErr errtools.HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected HTTPStatusError, got %v", err)
+	}
+
+	if statusErr.StatusCode != http.StatusInternalServerError || len(statusErr.Body) != webtools.MaxErrorBodySize {
+		t.Errorf("Expected status 500 with a truncated body, got %d with %d bytes", statusErr.StatusCode, len(statusErr.Body))
+	}
+}
+
+func TestExecuteInto(t *testing.T) {
+	srv := decodeServer()
+	defer srv.Close()
+
+	_, err := webtools.ExecuteInto[decodeUser, *decodeApiError](webtools.GetRequest(srv.URL + "/users/2"))
+
+	var apiErr *decodeApiError
+	if !errors.As(err, &apiErr) || apiErr.Code != "not_found" {
+		t.Fatalf("Expected decoded api error, got %v", err)
+	}
+
+	var statusErr errtools.HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the api error to carry the status, got %v", err)
+	}
+
+	_, err = webtools.ExecuteInto[decodeUser, decodeValueError](webtools.GetRequest(srv.URL + "/users/2"))
+
+	var valueErr decodeValueError
+	if !errors.As(err, &valueErr) || valueErr.Code != "not_found" || !errors.As(err, &statusErr) {
+		t.Errorf("Expected a decoded value type api error with the status, got %v", err)
+	}
+
+	for _, path := range []string{"/fail", "/mismatch"} {
+		_, err = webtools.ExecuteInto[decodeUser, *decodeApiError](webtools.GetRequest(srv.URL + path))
+		if !errors.As(err, &statusErr) || errors.As(err, &apiErr) {
+			t.Errorf("%s: expected only an HTTPStatusError for a body that is not an api error, got %v", path, err)
+		}
+
+		_, err = webtools.ExecuteInto[decodeUser, decodeValueError](webtools.GetRequest(srv.URL + path))
+		if !errors.As(err, &statusErr) || errors.As(err, &valueErr) {
+			t.Errorf("%s: expected only an HTTPStatusError for a value type, got %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package webtools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+type DownloadOptions struct {
+	// Continue a previously interrupted download from the partial file next to the destination,
+	// parallel downloads only request the chunks that were not completed
+	Resume bool
+
+	// Split the download into this many ranged requests sent in parallel, when the server
+	// supports ranges and the file is at least MinChunkSize bytes per chunk
+	Parallel     int
+	MinChunkSize int64
+
+	// Expected hex encoded sha256 of the complete file
+	Sha256 string
+
+	// Called as data is written, total is -1 when the size is unknown.
+	// Parallel downloads call it from several goroutines
+	Progress func(written, total int64)
+}
+
+// Saved next to a partial download to check that a resumed download is for the same file
+type downloadState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Total        int64  `json:"total"`
+
+	// Set for parallel downloads, the start offsets of the chunks that are complete
+	ChunkSize int64   `json:"chunk_size,omitempty"`
+	Completed []int64 `json:"completed,omitempty"`
+}
+
+// Stream the response of a GET request to dstPath and return the size of the file. The data is
+// written to dstPath.part and moved to dstPath once it is complete and the checksum matches
+func Download(req *RestRequest, dstPath string, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+
+	partPath := dstPath + ".part"
+	statePath := dstPath + ".part.json"
+
+	dl := &download{req: req, opts: opts, partPath: partPath, statePath: statePath}
+
+	var err error
+	if opts.Parallel > 1 {
+		err = dl.parallel()
+	} else {
+		err = dl.sequential()
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := dl.verify(); err != nil {
+		os.Remove(partPath)
+		os.Remove(statePath)
+		return 0, err
+	}
+
+	if err := os.Rename(partPath, dstPath); err != nil {
+		return 0, err
+	}
+
+	os.Remove(statePath)
+
+	return dl.written.Load(), nil
+}
+
+type download struct {
+	req       *RestRequest
+	opts      *DownloadOptions
+	partPath  string
+	statePath string
+	total     int64
+	written   atomic.Int64
+}
+
+func (dl *download) sequential() error {
+	offset := int64(0)
+	state := &downloadState{}
+
+	if dl.opts.Resume {
+		offset, state = dl.partial()
+	}
+
+	return dl.fetch(offset, state)
+}
+
+// Download the file from offset, appending to the partial file when the server returns the requested range
+func (dl *download) fetch(offset int64, state *downloadState) error {
+	rangeReq := dl.request()
+	if offset > 0 {
+		rangeReq = rangeReq.WithHeader("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+
+		if validator := state.validator(); validator != "" {
+			rangeReq = rangeReq.WithHeader("If-Range", validator)
+		}
+	}
+
+	resp, err := rangeReq.Execute()
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// A range that does not continue the partial file would corrupt it, start over instead
+		if start, _, _, ok := parseContentRange(resp.Response.Header.Get("Content-Range")); !ok || start != offset {
+			resp.discard()
+			return dl.fetch(0, &downloadState{})
+		}
+
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && offset == state.Total:
+		// The partial file is already complete
+		dl.total = offset
+		dl.written.Store(offset)
+		return nil
+	case resp.IsSuccess():
+		offset = 0
+	default:
+		return resp.StatusError()
+	}
+
+	dl.total = -1
+	if resp.Response.ContentLength >= 0 {
+		dl.total = offset + resp.Response.ContentLength
+	}
+
+	state = &downloadState{
+		ETag:         resp.Response.Header.Get("ETag"),
+		LastModified: resp.Response.Header.Get("Last-Modified"),
+		Total:        dl.total,
+	}
+
+	if err := state.save(dl.statePath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dl.partPath, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dl.written.Store(offset)
+	resp.bodyRead = true
+
+	if _, err := io.Copy(&downloadWriter{dl: dl, dst: file}, resp.Response.Body); err != nil {
+		return err
+	}
+
+	if dl.total >= 0 && dl.written.Load() != dl.total {
+		return io.ErrUnexpectedEOF
+	}
+
+	dl.total = dl.written.Load()
+
+	return file.Sync()
+}
+
+func (dl *download) parallel() error {
+	// Probe with a ranged GET instead of HEAD, presigned urls are only valid for GET
+	probe, err := dl.request().WithHeader("Range", "bytes=0-0").Execute()
+	if err != nil {
+		return err
+	}
+	probe.Close()
+
+	size := int64(-1)
+	if probe.StatusCode == http.StatusPartialContent {
+		if start, end, total, ok := parseContentRange(probe.Response.Header.Get("Content-Range")); ok && start == 0 && end == 0 {
+			size = total
+		}
+	}
+
+	// Servers that reject the probe or do not support ranges get a single request
+	chunks := int64(dl.opts.Parallel)
+	if size <= 0 || size < chunks*dl.opts.MinChunkSize {
+		return dl.sequential()
+	}
+
+	dl.total = size
+	chunkSize := (size + chunks - 1) / chunks
+
+	state := &downloadState{
+		ETag:         probe.Response.Header.Get("ETag"),
+		LastModified: probe.Response.Header.Get("Last-Modified"),
+		Total:        size,
+		ChunkSize:    chunkSize,
+	}
+	validator := state.validator()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if previous := dl.savedState(); dl.opts.Resume && validator != "" && previous.validator() == validator && previous.Total == size && previous.ChunkSize == chunkSize {
+		state.Completed = previous.Completed
+		flags = os.O_CREATE | os.O_WRONLY
+	}
+
+	if err := state.save(dl.statePath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dl.partPath, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	errs := make([]error, chunks)
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for i := int64(0); i < chunks; i++ {
+		start, end := i*chunkSize, min((i+1)*chunkSize, size)-1
+		if start > end {
+			break
+		}
+
+		if slices.Contains(state.Completed, start) {
+			dl.written.Add(end - start + 1)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if errs[i] = dl.chunk(file, start, end, validator); errs[i] != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			state.Completed = append(state.Completed, start)
+			errs[i] = state.save(dl.statePath)
+		}()
+	}
+
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func (dl *download) chunk(file *os.File, start, end int64, validator string) error {
+	chunkReq := dl.request().WithHeader("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+	if validator != "" {
+		chunkReq = chunkReq.WithHeader("If-Range", validator)
+	}
+
+	resp, err := chunkReq.Execute()
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.IsSuccess() {
+			return errtools.InvalidFieldError("server did not return the requested range")
+		}
+
+		return resp.StatusError()
+	}
+
+	if rangeStart, rangeEnd, total, ok := parseContentRange(resp.Response.Header.Get("Content-Range")); !ok || rangeStart != start || rangeEnd != end || total != dl.total {
+		return errtools.InvalidFieldError("server returned range " + resp.Response.Header.Get("Content-Range") + " for bytes " + strconv.FormatInt(start, 10) + "-" + strconv.FormatInt(end, 10))
+	}
+
+	resp.bodyRead = true
+
+	written, err := io.Copy(&downloadWriter{dl: dl, dst: io.NewOffsetWriter(file, start)}, resp.Response.Body)
+	if err != nil {
+		return err
+	}
+
+	if written != end-start+1 {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+// Parse a Content-Range header of the form "bytes start-end/total", the total has to be known
+func parseContentRange(value string) (int64, int64, int64, bool) {
+	spec, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	span, totalStr, _ := strings.Cut(spec, "/")
+	startStr, endStr, _ := strings.Cut(span, "-")
+
+	start, err1 := strconv.ParseInt(startStr, 10, 64)
+	end, err2 := strconv.ParseInt(endStr, 10, 64)
+	total, err3 := strconv.ParseInt(totalStr, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || start > end || end >= total {
+		return 0, 0, 0, false
+	}
+
+	return start, end, total, true
+}
+
+// Every download request is a GET without transparent compression, so offsets match the file on the server
+func (dl *download) request() *RestRequest {
+	return dl.req.Clone().withMethod(GET).WithHeader("Accept-Encoding", "identity")
+}
+
+// Size and state of an existing partial download, zero if there is none. A partial parallel
+// download has holes and cannot be continued sequentially
+func (dl *download) partial() (int64, *downloadState) {
+	stat, err := os.Stat(dl.partPath)
+	if err != nil {
+		return 0, &downloadState{}
+	}
+
+	state := dl.savedState()
+	if state.validator() == "" || state.ChunkSize > 0 {
+		return 0, &downloadState{}
+	}
+
+	return stat.Size(), state
+}
+
+// The saved state of a partial download, empty if there is none
+func (dl *download) savedState() *downloadState {
+	state := &downloadState{}
+
+	data, err := os.ReadFile(dl.statePath)
+	if err != nil || json.Unmarshal(data, state) != nil {
+		return &downloadState{}
+	}
+
+	return state
+}
+
+func (dl *download) verify() error {
+	if dl.opts.Sha256 == "" {
+		return nil
+	}
+
+	file, err := os.Open(dl.partPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, dl.opts.Sha256) {
+		return errtools.ChecksumMismatchError("expected sha256 " + dl.opts.Sha256 + ", got " + sum)
+	}
+
+	return nil
+}
+
+// Prefer the ETag as If-Range validator, weak ETags cannot be used
+func (ds *downloadState) validator() string {
+	if ds.ETag != "" && !strings.HasPrefix(ds.ETag, "W/") {
+		return ds.ETag
+	}
+
+	return ds.LastModified
+}
+
+func (ds *downloadState) save(path string) error {
+	data, err := json.Marshal(ds)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+type downloadWriter struct {
+	dl  *download
+	dst io.Writer
+}
+
+func (dw *downloadWriter) Write(p []byte) (int, error) {
+	n, err := dw.dst.Write(p)
+
+	written := dw.dl.written.Add(int64(n))
+	if dw.dl.opts.Progress != nil {
+		dw.dl.opts.Progress(written, dw.dl.total)
+	}
+
+	return n, err
+}
@@ -0,0 +1,296 @@
+package webtools_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+var downloadContent = bytes.Repeat([]byte("0123456789abcdef"), 64<<10)
+
+func downloadChecksum() string {
+	sum := sha256.Sum256(downloadContent)
+	return hex.EncodeToString(sum[:])
+}
+
+func downloadServer(interrupt *atomic.Bool, ranges *[]string) *httptest.Server {
+	mu := sync.Mutex{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		// Like presigned urls, the server only accepts GET requests
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+
+		if interrupt.CompareAndSwap(true, false) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(downloadContent)))
+			w.Write(downloadContent[:len(downloadContent)/3])
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+}
+
+func checkDownload(t *testing.T, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, downloadContent) {
+		t.Errorf("Downloaded file differs, got %d bytes", len(data))
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	interrupt := &atomic.Bool{}
+	interrupt.Store(true)
+	ranges := []string{}
+
+	srv := downloadServer(interrupt, &ranges)
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+	opts := &webtools.DownloadOptions{Resume: true, Sha256: downloadChecksum()}
+
+	if _, err := webtools.Download(webtools.GetRequest(srv.URL), dst, opts); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+
+	lastWritten := int64(0)
+	opts.Progress = func(written, total int64) {
+		lastWritten = written
+	}
+
+	size, err := webtools.Download(webtools.GetRequest(srv.URL), dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkDownload(t, dst)
+
+	if size != int64(len(downloadContent)) || lastWritten != size {
+		t.Errorf("Expected size and progress of %d, got %d and %d", len(downloadContent), size, lastWritten)
+	}
+
+	if expected := "bytes=" + strconv.Itoa(len(downloadContent)/3) + "-"; len(ranges) != 2 || ranges[1] != expected {
+		t.Errorf("Expected the second request to resume with %s, got %v", expected, ranges)
+	}
+
+	if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+		t.Error("Expected the partial file to be removed")
+	}
+}
+
+func TestDownloadResumeWrongRange(t *testing.T) {
+	interrupt := &atomic.Bool{}
+	interrupt.Store(true)
+	ranges := []string{}
+
+	srv := downloadServer(interrupt, &ranges)
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+	opts := &webtools.DownloadOptions{Resume: true, Sha256: downloadChecksum()}
+
+	if _, err := webtools.Download(webtools.GetRequest(srv.URL), dst, opts); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+
+	resumed := []string{}
+
+	// The server answers the resumed request from the start of the file
+	wrong := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resumed = append(resumed, r.Header.Get("Range"))
+
+		if r.Header.Get("Range") != "" {
+			r.Header.Set("Range", "bytes=0-")
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+	defer wrong.Close()
+
+	size, err := webtools.Download(webtools.GetRequest(wrong.URL), dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkDownload(t, dst)
+
+	if size != int64(len(downloadContent)) || len(resumed) != 2 || resumed[1] != "" {
+		t.Errorf("Expected the download to start over after the wrong range, got %d bytes and requests %v", size, resumed)
+	}
+}
+
+func TestDownloadParallel(t *testing.T) {
+	ranges := []string{}
+
+	srv := downloadServer(&atomic.Bool{}, &ranges)
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+
+	if _, err := webtools.Download(webtools.GetRequest(srv.URL), dst, &webtools.DownloadOptions{Parallel: 4, Sha256: downloadChecksum()}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkDownload(t, dst)
+
+	// One ranged probe to find the size and one request per chunk
+	if len(ranges) != 5 || ranges[0] != "bytes=0-0" {
+		t.Errorf("Expected 5 requests, got %v", ranges)
+	}
+}
+
+func TestDownloadParallelResume(t *testing.T) {
+	chunkSize := len(downloadContent) / 4
+	failing := fmt.Sprintf("bytes=%d-%d", 2*chunkSize, 3*chunkSize-1)
+	failed := &atomic.Bool{}
+
+	mu := sync.Mutex{}
+	ranges := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		if r.Header.Get("Range") == failing && failed.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+	opts := &webtools.DownloadOptions{Parallel: 4, Resume: true, Sha256: downloadChecksum()}
+
+	if _, err := webtools.Download(webtools.GetRequest(srv.URL), dst, opts); err == nil {
+		t.Fatal("Expected the download with a failed chunk to fail")
+	}
+
+	ranges = ranges[:0]
+
+	size, err := webtools.Download(webtools.GetRequest(srv.URL), dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkDownload(t, dst)
+
+	if size != int64(len(downloadContent)) || len(ranges) != 2 || ranges[1] != failing {
+		t.Errorf("Expected only the failed chunk to be requested again, got %v", ranges)
+	}
+}
+
+func TestDownloadParallelFallback(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		// Ranges are ignored, the probe returns the whole file
+		"no ranges": func(w http.ResponseWriter, r *http.Request) {
+			w.Write(downloadContent)
+		},
+		// The probe is rejected, the download itself is allowed
+		"probe rejected": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			w.Write(downloadContent)
+		},
+	}
+
+	for name, handler := range tests {
+		requests := &atomic.Int32{}
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			handler(w, r)
+		}))
+
+		dst := filepath.Join(t.TempDir(), "file.bin")
+
+		if _, err := webtools.Download(webtools.GetRequest(srv.URL), dst, &webtools.DownloadOptions{Parallel: 4}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+
+		checkDownload(t, dst)
+
+		if requests.Load() != 2 {
+			t.Errorf("%s: expected the probe and a single download request, got %d requests", name, requests.Load())
+		}
+
+		srv.Close()
+	}
+}
+
+func TestDownloadParallelWrongRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every chunk is answered with the start of the file
+		if start, end, ok := strings.Cut(strings.TrimPrefix(r.Header.Get("Range"), "bytes="), "-"); ok {
+			from, _ := strconv.Atoi(start)
+			to, _ := strconv.Atoi(end)
+			r.Header.Set("Range", fmt.Sprintf("bytes=0-%d", to-from))
+		}
+
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+
+	_, err := webtools.Download(webtools.GetRequest(srv.URL), dst, &webtools.DownloadOptions{Parallel: 4})
+
+	var rangeErr errtools.InvalidFieldError
+	if !errors.As(err, &rangeErr) {
+		t.Errorf("Expected an error for a chunk with the wrong range, got %v", err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	ranges := []string{}
+
+	srv := downloadServer(&atomic.Bool{}, &ranges)
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "file.bin")
+
+	_, err := webtools.Download(webtools.GetRequest(srv.URL), dst, &webtools.DownloadOptions{Sha256: "00"})
+
+	var checksumErr errtools.ChecksumMismatchError
+	if !errors.As(err, &checksumErr) {
+		t.Errorf("Expected ChecksumMismatchError, got %v", err)
+	}
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("Expected no file at the destination")
+	}
+}
@@ -0,0 +1,79 @@
+package webtools_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func TestMultiValuedHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Values("Accept"); !slices.Equal(accept, []string{"application/json", "text/plain"}) {
+			t.Errorf("Expected two accept values, got %v", accept)
+		}
+
+		if r.Header.Get("X-Removed") != "" {
+			t.Error("Expected deleted header not to be sent")
+		}
+
+		if r.Header.Get("X-Direct") != "direct" {
+			t.Errorf("Expected header written to the map to be sent, got %q", r.Header.Get("X-Direct"))
+		}
+
+		if r.Header.Get("X-Trace") != "client" {
+			t.Errorf("Expected client default header, got %q", r.Header.Get("X-Trace"))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req := webtools.NewRestClient(srv.URL).AddHeader("x-trace", "client").Get("/").
+		AddHeader("accept", "application/json").
+		AddHeader("Accept", "text/plain").
+		WithHeader("x-removed", "value").
+		DelHeader("X-Removed")
+
+	req.Headers["X-Direct"] = "direct"
+
+	if req.Headers["Accept"] != "application/json" {
+		t.Errorf("Expected the map to hold the first canonical value, got %v", req.Headers)
+	}
+
+	resp, err := req.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+func TestHeadersDeletedFromMap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-A") != "" || r.Header.Get("X-Trace") != "" {
+			t.Errorf("Expected headers deleted from the map not to be sent, got %v", r.Header)
+		}
+
+		if r.Header.Get("X-B") != "2" {
+			t.Errorf("Expected the remaining header to be sent, got %q", r.Header.Get("X-B"))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	req := webtools.NewRestClient(srv.URL).WithHeader("X-Trace", "client").Get("/").
+		WithHeader("X-A", "1").
+		WithHeader("X-B", "2")
+
+	delete(req.Headers, "X-A")
+	delete(req.Headers, "X-Trace")
+
+	resp, err := req.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
@@ -0,0 +1,54 @@
+package webtools
+
+import (
+	"net/http"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// Doer sends a prepared request
+type Doer interface {
+	Do(*http.Request) (*RestResponse, error)
+}
+
+type DoerFunc func(*http.Request) (*RestResponse, error)
+
+func (f DoerFunc) Do(req *http.Request) (*RestResponse, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer that sends a request. It sees the final http.Request of every
+// attempt, including retries and authorization challenges, and may return a response
+// without calling next
+type Middleware func(next Doer) Doer
+
+// Add middleware to the request, the first middleware added is the outermost
+func (r *RestRequest) WithMiddleware(middleware ...Middleware) *RestRequest {
+	for _, mw := range middleware {
+		if mw == nil {
+			r.addError(errtools.MissingValueError("middleware"))
+			return r
+		}
+	}
+
+	r.middleware = append(r.middleware, middleware...)
+
+	return r
+}
+
+func (r *RestRequest) doer() Doer {
+	var doer Doer = DoerFunc(func(req *http.Request) (*RestResponse, error) {
+		resp, err := r.client.httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewRestResponse(resp), nil
+	})
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		doer = r.middleware[i](doer)
+	}
+
+	return doer
+}
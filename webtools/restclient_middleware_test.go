@@ -0,0 +1,91 @@
+package webtools_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func recordingMiddleware(name string, calls *[]string) webtools.Middleware {
+	return func(next webtools.Doer) webtools.Doer {
+		return webtools.DoerFunc(func(req *http.Request) (*webtools.RestResponse, error) {
+			*calls = append(*calls, name+":request")
+			resp, err := next.Do(req)
+			*calls = append(*calls, name+":response")
+			return resp, err
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Injected") != "true" {
+			t.Error("Expected header injected by middleware")
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	calls := []string{}
+	authorization := ""
+
+	inject := func(next webtools.Doer) webtools.Doer {
+		return webtools.DoerFunc(func(req *http.Request) (*webtools.RestResponse, error) {
+			authorization = req.Header.Get("Authorization")
+			req.Header.Set("X-Injected", "true")
+			return next.Do(req)
+		})
+	}
+
+	client := webtools.NewRestClient(srv.URL).
+		WithAuthorization(&webtools.BearerToken{Token: "token"}).
+		WithMiddleware(recordingMiddleware("client", &calls))
+
+	resp, err := client.Get("/").WithMiddleware(recordingMiddleware("request", &calls), inject).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	expected := []string{"client:request", "request:request", "request:response", "client:response"}
+	if !slices.Equal(calls, expected) {
+		t.Errorf("Expected middleware calls %v, got %v", expected, calls)
+	}
+
+	if authorization != "Bearer token" {
+		t.Errorf("Expected middleware to see the authorization header, got %q", authorization)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	fault := func(next webtools.Doer) webtools.Doer {
+		return webtools.DoerFunc(func(req *http.Request) (*webtools.RestResponse, error) {
+			return webtools.NewRestResponse(&http.Response{
+				StatusCode: http.StatusTeapot,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("short circuit")),
+				Request:    req,
+			}), nil
+		})
+	}
+
+	resp, err := webtools.GetRequest("http://unreachable.invalid").WithMiddleware(fault).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := resp.BodyAsBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusTeapot || string(body) != "short circuit" {
+		t.Errorf("Expected the middleware response, got %d %q", resp.StatusCode, string(body))
+	}
+}
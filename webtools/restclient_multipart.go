@@ -3,24 +3,42 @@ package webtools
 import (
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/scheiblingco/gofn/errtools"
 )
 
+// Called while a field is written, total is -1 when the size of the field is unknown
+type MultipartProgress func(field string, written, total int64)
+
 type MultipartField struct {
 	Key         string
 	value       io.Reader
+	path        *string
 	filename    *string
 	contentType *string
 }
 
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
 func NewMultipartField(key string) *MultipartField {
 	return &MultipartField{
 		Key: key,
 	}
 }
 
+// Create a field that uploads the file at path, see WithFile
+func NewMultipartFileField(key, path string) *MultipartField {
+	return NewMultipartField(key).WithFile(path)
+}
+
 func (m *MultipartField) WithStringValue(value string) *MultipartField {
 	m.value = strings.NewReader(value)
 	return m
@@ -36,6 +54,13 @@ func (m *MultipartField) WithReaderValue(value io.Reader) *MultipartField {
 	return m
 }
 
+// Read the value from the file at path when the field is written. The filename defaults to the
+// base name of the path and the content type is detected from the extension or the content
+func (m *MultipartField) WithFile(path string) *MultipartField {
+	m.path = &path
+	return m
+}
+
 func (m *MultipartField) WithFilename(filename string) *MultipartField {
 	m.filename = &filename
 	return m
@@ -52,23 +77,31 @@ func (m *MultipartField) WithPipe(pipe *io.PipeReader) *MultipartField {
 }
 
 func (m *MultipartField) AddToWriter(w *multipart.Writer) error {
-	if x, ok := m.value.(io.Closer); ok {
+	return m.addToWriter(w, nil)
+}
+
+func (m *MultipartField) addToWriter(w *multipart.Writer, progress MultipartProgress) error {
+	value, filename, contentType, total, err := m.source()
+	if err != nil {
+		return err
+	}
+
+	if x, ok := value.(io.Closer); ok {
 		defer x.Close()
 	}
 
 	var fw io.Writer
-	var err error
 
-	if m.filename != nil || m.contentType != nil {
+	if filename != nil || contentType != nil {
 		partHeader := textproto.MIMEHeader{}
 
-		if m.filename != nil {
-			disp := fmt.Sprintf(`form-data; name="%s"; filename="%s"`, m.Key, *m.filename)
+		if filename != nil {
+			disp := fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(m.Key), quoteEscaper.Replace(*filename))
 			partHeader.Add("Content-Disposition", disp)
 		}
 
-		if m.contentType != nil {
-			partHeader.Add("Content-Type", *m.contentType)
+		if contentType != nil {
+			partHeader.Add("Content-Type", *contentType)
 		}
 
 		fw, err = w.CreatePart(partHeader)
@@ -80,9 +113,136 @@ func (m *MultipartField) AddToWriter(w *multipart.Writer) error {
 		return err
 	}
 
-	if _, err := io.Copy(fw, m.value); err != nil {
+	if progress != nil {
+		fw = &progressWriter{Writer: fw, field: m.Key, total: total, progress: progress}
+	}
+
+	if _, err := io.Copy(fw, value); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// Resolve the reader, filename, content type and size of the field
+func (m *MultipartField) source() (io.Reader, *string, *string, int64, error) {
+	if m.path == nil {
+		if m.value == nil {
+			return nil, nil, nil, 0, errtools.MissingValueError("multipart field " + m.Key)
+		}
+
+		total := int64(-1)
+		if sized, ok := m.value.(interface{ Len() int }); ok {
+			total = int64(sized.Len())
+		}
+
+		return m.value, m.filename, m.contentType, total, nil
+	}
+
+	file, err := os.Open(*m.path)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, 0, err
+	}
+
+	filename := m.filename
+	if filename == nil {
+		base := filepath.Base(*m.path)
+		filename = &base
+	}
+
+	contentType := m.contentType
+	if contentType == nil {
+		detected := mime.TypeByExtension(filepath.Ext(*m.path))
+
+		if detected == "" {
+			sniff := make([]byte, 512)
+			n, err := io.ReadFull(file, sniff)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				file.Close()
+				return nil, nil, nil, 0, err
+			}
+
+			detected = http.DetectContentType(sniff[:n])
+
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				file.Close()
+				return nil, nil, nil, 0, err
+			}
+		}
+
+		contentType = &detected
+	}
+
+	return file, filename, contentType, stat.Size(), nil
+}
+
+type progressWriter struct {
+	io.Writer
+	field    string
+	written  int64
+	total    int64
+	progress MultipartProgress
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.Writer.Write(p)
+	pw.written += int64(n)
+	pw.progress(pw.field, pw.written, pw.total)
+
+	return n, err
+}
+
+// Body that writes the multipart fields into a pipe once the transport starts reading it
+type multipartStream struct {
+	fields   []MultipartField
+	progress MultipartProgress
+	reader   *io.PipeReader
+	writer   *io.PipeWriter
+	mpWriter *multipart.Writer
+	start    sync.Once
+}
+
+func newMultipartStream(fields []MultipartField, progress MultipartProgress) *multipartStream {
+	reader, writer := io.Pipe()
+
+	return &multipartStream{
+		fields:   fields,
+		progress: progress,
+		reader:   reader,
+		writer:   writer,
+		mpWriter: multipart.NewWriter(writer),
+	}
+}
+
+func (ms *multipartStream) Read(p []byte) (int, error) {
+	ms.start.Do(func() {
+		go ms.write()
+	})
+
+	return ms.reader.Read(p)
+}
+
+func (ms *multipartStream) Close() error {
+	ms.start.Do(func() {
+		ms.writer.Close()
+	})
+
+	return ms.reader.Close()
+}
+
+func (ms *multipartStream) write() {
+	for _, field := range ms.fields {
+		if err := field.addToWriter(ms.mpWriter, ms.progress); err != nil {
+			ms.writer.CloseWithError(err)
+			return
+		}
+	}
+
+	ms.writer.CloseWithError(ms.mpWriter.Close())
+}
@@ -0,0 +1,108 @@
+package webtools_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func TestStreamingMultipart(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "data.json")
+	blobPath := filepath.Join(dir, "blob")
+	largeContent := strings.Repeat("streamed content ", 64<<10)
+
+	if err := os.WriteFile(jsonPath, []byte(`{"key":"value"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(blobPath, []byte(largeContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type part struct {
+		filename    string
+		contentType string
+		content     string
+	}
+
+	parts := map[string]part{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 {
+			t.Errorf("Expected a chunked body of unknown length, got %d", r.ContentLength)
+		}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for {
+			p, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, _ := io.ReadAll(p)
+			parts[p.FormName()] = part{p.FileName(), p.Header.Get("Content-Type"), string(content)}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	mu := sync.Mutex{}
+	progress := map[string][2]int64{}
+
+	resp, err := webtools.PostRequest(srv.URL).WithStreamingMultipartFormBody([]webtools.MultipartField{
+		*webtools.NewMultipartField("name").WithStringValue("upload"),
+		*webtools.NewMultipartFileField("json", jsonPath),
+		*webtools.NewMultipartFileField("blob", blobPath).WithFilename("renamed.txt"),
+	}, func(field string, written, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress[field] = [2]int64{written, total}
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	expected := map[string]part{
+		"name": {"", "", "upload"},
+		"json": {"data.json", "application/json", `{"key":"value"}`},
+		"blob": {"renamed.txt", "text/plain; charset=utf-8", largeContent},
+	}
+
+	for name, want := range expected {
+		if got := parts[name]; got != want {
+			t.Errorf("Unexpected part %s: got %q %q (%d bytes)", name, got.filename, got.contentType, len(got.content))
+		}
+	}
+
+	if p := progress["blob"]; p[0] != int64(len(largeContent)) || p[1] != int64(len(largeContent)) {
+		t.Errorf("Expected progress to reach %d bytes, got %v", len(largeContent), p)
+	}
+}
+
+func TestStreamingMultipartMissingFile(t *testing.T) {
+	err := webtools.PostRequest("http://localhost").WithStreamingMultipartFormBody([]webtools.MultipartField{
+		*webtools.NewMultipartFileField("file", filepath.Join(t.TempDir(), "missing")),
+	}, nil).Validate()
+
+	if err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,350 @@
+package webtools
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// Maximum number of pages fetched when PageOptions.MaxPages is not set
+var DefaultMaxPages = 1000
+
+// PageStrategy builds the request for the page following resp, returning nil when there are no more pages.
+// items is the number of items decoded from the current page
+type PageStrategy interface {
+	Next(req *RestRequest, resp *RestResponse, body []byte, items int) (*RestRequest, error)
+}
+
+type PageOptions struct {
+	// Dot separated path to the items array in the body, empty when the body is the array
+	ItemsPath string
+
+	// Stop with an errtools.LimitExceededError after this many pages
+	MaxPages int
+}
+
+// Iterate over the pages of a paginated api, starting with req which is sent as-is.
+// Iteration stops at the first error, which is yielded
+func Pages[T any](ctx context.Context, req *RestRequest, strategy PageStrategy, opts *PageOptions) iter.Seq2[[]T, error] {
+	if opts == nil {
+		opts = &PageOptions{}
+	}
+
+	maxPages := opts.MaxPages
+	if maxPages <= 0 {
+		maxPages = DefaultMaxPages
+	}
+
+	return func(yield func([]T, error) bool) {
+		current := req
+
+		for page := 1; current != nil; page++ {
+			if page > maxPages {
+				yield(nil, errtools.LimitExceededError("more than "+strconv.Itoa(maxPages)+" pages"))
+				return
+			}
+
+			if err := ctx.Err(); err != nil {
+				yield(nil, current.wrapError(ctx, err))
+				return
+			}
+
+			items, next, err := fetchPage[T](ctx, current, strategy, opts.ItemsPath)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if !yield(items, nil) {
+				return
+			}
+
+			current = next
+		}
+	}
+}
+
+// Iterate over the items of all pages of a paginated api, see Pages
+func Items[T any](ctx context.Context, req *RestRequest, strategy PageStrategy, opts *PageOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for items, err := range Pages[T](ctx, req, strategy, opts) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func fetchPage[T any](ctx context.Context, req *RestRequest, strategy PageStrategy, itemsPath string) ([]T, *RestRequest, error) {
+	resp, err := req.ExecuteContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Close()
+
+	if !resp.IsSuccess() {
+		return nil, nil, resp.StatusError()
+	}
+
+	body, err := resp.BodyAsBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items := []T{}
+
+	raw, ok, err := jsonPath(body, itemsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ok {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	next, err := strategy.Next(req, resp, body, len(items))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return items, next, nil
+}
+
+// LinkHeaderPagination follows the RFC 5988 Link header with rel="next"
+type LinkHeaderPagination struct{}
+
+func (LinkHeaderPagination) Next(req *RestRequest, resp *RestResponse, body []byte, items int) (*RestRequest, error) {
+	nextUrl, ok := parseLinkHeader(http.Header(resp.Headers).Values("Link"))["next"]
+	if !ok {
+		return nil, nil
+	}
+
+	base, err := url.Parse(req.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := url.Parse(nextUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	next := req.Clone()
+	next.Url = base.ResolveReference(ref).String()
+
+	return next, nil
+}
+
+// CursorPagination reads the cursor for the next page at CursorPath in the body
+// and sends it in the query parameter Param, an empty or missing cursor ends the pagination
+type CursorPagination struct {
+	CursorPath string
+	Param      string
+}
+
+func (cp *CursorPagination) Next(req *RestRequest, resp *RestResponse, body []byte, items int) (*RestRequest, error) {
+	raw, ok, err := jsonPath(body, cp.CursorPath)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var cursor interface{}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+
+	switch value := cursor.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if value == "" {
+			return nil, nil
+		}
+
+		return withQueryParam(req, cp.Param, value)
+	default:
+		return withQueryParam(req, cp.Param, string(raw))
+	}
+}
+
+// OffsetPagination increments the offset parameter by the number of items on each page, the
+// pagination ends on an empty page or when fewer than Limit items are returned
+type OffsetPagination struct {
+	OffsetParam string
+	LimitParam  string
+	Limit       int
+}
+
+func (op *OffsetPagination) Next(req *RestRequest, resp *RestResponse, body []byte, items int) (*RestRequest, error) {
+	if items == 0 || (op.Limit > 0 && items < op.Limit) {
+		return nil, nil
+	}
+
+	offset, err := queryInt(req.Url, op.OffsetParam, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := withQueryParam(req, op.OffsetParam, strconv.Itoa(offset+items))
+	if err != nil || op.LimitParam == "" || op.Limit <= 0 {
+		return next, err
+	}
+
+	return withQueryParam(next, op.LimitParam, strconv.Itoa(op.Limit))
+}
+
+// PageNumberPagination increments the page parameter, starting from FirstPage (default 1), the
+// pagination ends on an empty page or when fewer than Size items are returned
+type PageNumberPagination struct {
+	PageParam string
+	SizeParam string
+	Size      int
+	FirstPage int
+}
+
+func (pp *PageNumberPagination) Next(req *RestRequest, resp *RestResponse, body []byte, items int) (*RestRequest, error) {
+	if items == 0 || (pp.Size > 0 && items < pp.Size) {
+		return nil, nil
+	}
+
+	firstPage := pp.FirstPage
+	if firstPage == 0 {
+		firstPage = 1
+	}
+
+	page, err := queryInt(req.Url, pp.PageParam, firstPage)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := withQueryParam(req, pp.PageParam, strconv.Itoa(page+1))
+	if err != nil || pp.SizeParam == "" || pp.Size <= 0 {
+		return next, err
+	}
+
+	return withQueryParam(next, pp.SizeParam, strconv.Itoa(pp.Size))
+}
+
+func withQueryParam(req *RestRequest, key, value string) (*RestRequest, error) {
+	next := req.Clone()
+	if err := next.setQueryParam(key, value); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+func queryInt(rawUrl, key string, defaultValue int) (int, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return 0, err
+	}
+
+	value := parsed.Query().Get(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsedInt, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errtools.InvalidTypeError("query parameter " + key + " is not an integer")
+	}
+
+	return parsedInt, nil
+}
+
+// Parse Link header values into a map of rel to url
+func parseLinkHeader(values []string) map[string]string {
+	entries := []string{}
+
+	// Commas separate links, but may also appear inside a url
+	for _, value := range values {
+		for i, part := range strings.Split(value, ",") {
+			if i == 0 || strings.HasPrefix(strings.TrimSpace(part), "<") {
+				entries = append(entries, part)
+			} else {
+				entries[len(entries)-1] += "," + part
+			}
+		}
+	}
+
+	links := map[string]string{}
+
+	for _, link := range entries {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok {
+			continue
+		}
+
+		target = strings.Trim(strings.TrimSpace(target), "<>")
+
+		for _, param := range strings.Split(params, ";") {
+			key, rel, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(key) != "rel" {
+				continue
+			}
+
+			for _, name := range strings.Fields(strings.Trim(rel, `"`)) {
+				links[strings.ToLower(name)] = target
+			}
+		}
+	}
+
+	return links
+}
+
+// Look up a dot separated path of object keys and array indices in a json document,
+// the boolean is false if the path does not exist
+func jsonPath(body []byte, path string) (json.RawMessage, bool, error) {
+	raw := json.RawMessage(body)
+
+	if path == "" {
+		return raw, true, nil
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		if index, err := strconv.Atoi(key); err == nil {
+			array := []json.RawMessage{}
+			if err := json.Unmarshal(raw, &array); err != nil {
+				return nil, false, err
+			}
+
+			if index < 0 || index >= len(array) {
+				return nil, false, nil
+			}
+
+			raw = array[index]
+			continue
+		}
+
+		object := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, false, err
+		}
+
+		value, ok := object[key]
+		if !ok {
+			return nil, false, nil
+		}
+
+		raw = value
+	}
+
+	return raw, true, nil
+}
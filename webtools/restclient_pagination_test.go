@@ -0,0 +1,141 @@
+package webtools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+var pageItems = []int{1, 2, 3, 4, 5, 6, 7}
+
+func pageServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch r.URL.Path {
+		case "/link":
+			page, _ := strconv.Atoi(query.Get("page"))
+			start, end := page*3, min(page*3+3, len(pageItems))
+			if end < len(pageItems) {
+				w.Header().Set("Link", fmt.Sprintf(`</link?page=%d>; rel="next", </link?page=2>; rel="last"`, page+1))
+			}
+			json.NewEncoder(w).Encode(pageItems[start:end])
+
+		case "/cursor":
+			start, _ := strconv.Atoi(query.Get("cursor"))
+			end := min(start+3, len(pageItems))
+			next := interface{}(nil)
+			if end < len(pageItems) {
+				next = strconv.Itoa(end)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"items": pageItems[start:end]},
+				"meta": map[string]interface{}{"next": next},
+			})
+
+		case "/offset":
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			limit, _ := strconv.Atoi(query.Get("limit"))
+			json.NewEncoder(w).Encode(pageItems[min(offset, len(pageItems)):min(offset+limit, len(pageItems))])
+
+		case "/page":
+			page, _ := strconv.Atoi(query.Get("page"))
+			start := (page - 1) * 3
+			json.NewEncoder(w).Encode(pageItems[min(start, len(pageItems)):min(start+3, len(pageItems))])
+
+		case "/loop":
+			w.Header().Set("Link", `</loop>; rel="next"`)
+			json.NewEncoder(w).Encode([]int{1})
+		}
+	}))
+}
+
+func collectItems(t *testing.T, req *webtools.RestRequest, strategy webtools.PageStrategy, opts *webtools.PageOptions) []int {
+	items := []int{}
+
+	for item, err := range webtools.Items[int](context.Background(), req, strategy, opts) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+func TestPaginationStrategies(t *testing.T) {
+	srv := pageServer()
+	defer srv.Close()
+
+	client := webtools.NewRestClient(srv.URL)
+
+	tests := map[string]struct {
+		req      *webtools.RestRequest
+		strategy webtools.PageStrategy
+		opts     *webtools.PageOptions
+	}{
+		"link":   {client.Get("/link"), webtools.LinkHeaderPagination{}, nil},
+		"cursor": {client.Get("/cursor"), &webtools.CursorPagination{CursorPath: "meta.next", Param: "cursor"}, &webtools.PageOptions{ItemsPath: "data.items"}},
+		"offset": {client.Get("/offset?limit=3"), &webtools.OffsetPagination{OffsetParam: "offset", LimitParam: "limit", Limit: 3}, nil},
+		"page":   {client.Get("/page?page=1"), &webtools.PageNumberPagination{PageParam: "page", Size: 3}, nil},
+	}
+
+	for name, test := range tests {
+		if items := collectItems(t, test.req, test.strategy, test.opts); !slices.Equal(items, pageItems) {
+			t.Errorf("%s: expected items %v, got %v", name, pageItems, items)
+		}
+	}
+}
+
+func TestPaginationMaxPages(t *testing.T) {
+	srv := pageServer()
+	defer srv.Close()
+
+	pages := 0
+	var lastErr error
+
+	for _, err := range webtools.Pages[int](context.Background(), webtools.GetRequest(srv.URL+"/loop"), webtools.LinkHeaderPagination{}, &webtools.PageOptions{MaxPages: 5}) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		pages++
+	}
+
+	var limitErr errtools.LimitExceededError
+	if pages != 5 || !errors.As(lastErr, &limitErr) {
+		t.Errorf("Expected 5 pages and a limit error, got %d pages and %v", pages, lastErr)
+	}
+}
+
+func TestPaginationCanceled(t *testing.T) {
+	srv := pageServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lastErr error
+	for _, err := range webtools.Pages[int](ctx, webtools.GetRequest(srv.URL+"/loop"), webtools.LinkHeaderPagination{}, nil) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		cancel()
+	}
+
+	var cancelErr errtools.RequestCanceledError
+	if !errors.As(lastErr, &cancelErr) {
+		t.Errorf("Expected RequestCanceledError, got %v", lastErr)
+	}
+}
@@ -0,0 +1,61 @@
+package webtools
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+var pathParamPattern = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// Replace the {name} placeholder in the url path with the escaped value, a name that
+// does not appear in the url is reported by Validate
+func (r *RestRequest) WithPathParam(name, value string) *RestRequest {
+	if name == "" {
+		r.addError(errtools.InvalidKeyError("path parameter name cannot be empty"))
+		return r
+	}
+
+	path, rest := splitUrlPath(r.Url)
+	placeholder := "{" + name + "}"
+
+	if !strings.Contains(path, placeholder) {
+		r.addError(errtools.InvalidKeyError("path parameter " + name + " is not used in the url"))
+		return r
+	}
+
+	r.Url = strings.ReplaceAll(path, placeholder, url.PathEscape(value)) + rest
+
+	return r
+}
+
+func (r *RestRequest) WithPathParams(params map[string]string) *RestRequest {
+	for k, v := range params {
+		r = r.WithPathParam(k, v)
+	}
+
+	return r
+}
+
+// Placeholders in the url path that have not been replaced
+func unresolvedPathParams(rawUrl string) []string {
+	path, _ := splitUrlPath(rawUrl)
+
+	names := []string{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		names = append(names, match[1])
+	}
+
+	return names
+}
+
+// Split the url before the query or fragment
+func splitUrlPath(rawUrl string) (string, string) {
+	if i := strings.IndexAny(rawUrl, "?#"); i >= 0 {
+		return rawUrl[:i], rawUrl[i:]
+	}
+
+	return rawUrl, ""
+}
@@ -0,0 +1,48 @@
+package webtools_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func TestWithPathParams(t *testing.T) {
+	req := webtools.NewRestClient("https://example.com/api").
+		Get("/tenants/{tenant}/users/{id}?filter={raw}").
+		WithPathParams(map[string]string{
+			"tenant": "acme corp",
+			"id":     "a/b",
+		})
+
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Url != "https://example.com/api/tenants/acme%20corp/users/a%2Fb?filter={raw}" {
+		t.Errorf("Unexpected url %s", req.Url)
+	}
+}
+
+func TestWithPathParamsMissing(t *testing.T) {
+	err := webtools.GetRequest("https://example.com/tenants/{tenant}/users/{id}").
+		WithPathParam("tenant", "acme").
+		Validate()
+
+	var missing errtools.MissingValueError
+	if !errors.As(err, &missing) || string(missing) != "path parameter id" {
+		t.Errorf("Expected missing path parameter id, got %v", err)
+	}
+}
+
+func TestWithPathParamsUnused(t *testing.T) {
+	err := webtools.GetRequest("https://example.com/users").
+		WithPathParam("id", "1").
+		Validate()
+
+	var unused errtools.InvalidKeyError
+	if !errors.As(err, &unused) {
+		t.Errorf("Expected unused path parameter error, got %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package webtools
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/typetools"
+)
+
+// Append the values to the query of the url, existing parameters are kept
+func (r *RestRequest) WithQueryValues(values url.Values) *RestRequest {
+	if len(values) == 0 {
+		return r
+	}
+
+	for k := range values {
+		if k == "" {
+			r.addError(errtools.InvalidKeyError("query parameter key cannot be empty"))
+			return r
+		}
+	}
+
+	// The query is spliced into the url as written, so path placeholders are not escaped
+	base, fragment := r.Url, ""
+	if i := strings.Index(base, "#"); i >= 0 {
+		base, fragment = base[:i], base[i:]
+	}
+
+	separator := "?"
+	if strings.HasSuffix(base, "?") || strings.HasSuffix(base, "&") {
+		separator = ""
+	} else if strings.Contains(base, "?") {
+		separator = "&"
+	}
+
+	r.Url = base + separator + values.Encode() + fragment
+
+	return r
+}
+
+// Append the fields of a struct to the query of the url. Fields are named by the url tag,
+// `url:"name,omitempty,comma"`, where omitempty skips zero values and comma joins slices into
+// a single value instead of repeating the key. Times are formatted as RFC 3339, or with the
+// layout from a `layout:"..."` tag, or as unix seconds with the unix option
+func (r *RestRequest) WithQueryStruct(v interface{}) *RestRequest {
+	values := url.Values{}
+
+	if err := encodeQueryStruct(reflect.ValueOf(v), values); err != nil {
+		r.addError(err)
+		return r
+	}
+
+	return r.WithQueryValues(values)
+}
+
+type queryTag struct {
+	name      string
+	omitempty bool
+	comma     bool
+	unix      bool
+	layout    string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func encodeQueryStruct(rv reflect.Value, values url.Values) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return errtools.InvalidTypeError("query struct must be a struct or a pointer to a struct")
+	}
+
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+
+		// Embedded structs without a tag are flattened into the parent, even when the type is unexported
+		if field.Anonymous && field.Tag.Get("url") == "" && indirectType(field.Type).Kind() == reflect.Struct && indirectType(field.Type) != timeType {
+			if field.Type.Kind() == reflect.Pointer && !field.IsExported() {
+				continue
+			}
+
+			if err := encodeQueryStruct(fv, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, skip := parseQueryTag(field)
+		if skip {
+			continue
+		}
+
+		if err := encodeQueryField(fv, tag, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseQueryTag(field reflect.StructField) (queryTag, bool) {
+	tag := queryTag{name: field.Name, layout: field.Tag.Get("layout")}
+
+	parts := strings.Split(field.Tag.Get("url"), ",")
+	if parts[0] == "-" && len(parts) == 1 {
+		return tag, true
+	}
+
+	if parts[0] != "" {
+		tag.name = parts[0]
+	}
+
+	for _, option := range parts[1:] {
+		switch option {
+		case "omitempty":
+			tag.omitempty = true
+		case "comma":
+			tag.comma = true
+		case "unix":
+			tag.unix = true
+		}
+	}
+
+	return tag, false
+}
+
+func encodeQueryField(fv reflect.Value, tag queryTag, values url.Values) error {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+
+		fv = fv.Elem()
+	}
+
+	if tag.omitempty && fv.IsZero() {
+		return nil
+	}
+
+	if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && fv.Type().Elem().Kind() != reflect.Uint8 {
+		items := []string{}
+
+		for i := 0; i < fv.Len(); i++ {
+			item, err := queryValue(fv.Index(i), tag)
+			if err != nil {
+				return err
+			}
+
+			items = append(items, item)
+		}
+
+		if tag.comma {
+			if len(items) > 0 || !tag.omitempty {
+				values.Add(tag.name, strings.Join(items, ","))
+			}
+
+			return nil
+		}
+
+		for _, item := range items {
+			values.Add(tag.name, item)
+		}
+
+		return nil
+	}
+
+	value, err := queryValue(fv, tag)
+	if err != nil {
+		return err
+	}
+
+	values.Add(tag.name, value)
+
+	return nil
+}
+
+func queryValue(rv reflect.Value, tag queryTag) (string, error) {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return "", nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	if rv.Type() == timeType && rv.CanInterface() {
+		t := rv.Interface().(time.Time)
+
+		switch {
+		case tag.unix:
+			return typetools.EnsureString(t.Unix()), nil
+		case tag.layout != "":
+			return t.Format(tag.layout), nil
+		default:
+			return t.Format(time.RFC3339), nil
+		}
+	}
+
+	if rv.CanInterface() {
+		if stringer, ok := rv.Interface().(fmt.Stringer); ok {
+			return stringer.String(), nil
+		}
+	}
+
+	// Convert named types to their underlying kind so typetools can handle them
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return typetools.EnsureString(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return typetools.EnsureString(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return typetools.EnsureString(rv.Uint()), nil
+	case reflect.Float32:
+		return typetools.EnsureString(float32(rv.Float())), nil
+	case reflect.Float64:
+		return typetools.EnsureString(rv.Float()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
+	}
+
+	return "", errtools.InvalidTypeError("query parameter " + tag.name + " has unsupported type " + rv.Type().String())
+}
+
+func indirectType(rt reflect.Type) reflect.Type {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+
+	return rt
+}
@@ -0,0 +1,116 @@
+package webtools_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+type queryPaging struct {
+	Page int `url:"page,omitempty"`
+}
+
+type queryFilter struct {
+	queryPaging
+	Search  string    `url:"q"`
+	Tags    []string  `url:"tag"`
+	Fields  []string  `url:"fields,comma"`
+	Since   time.Time `url:"since"`
+	Until   time.Time `url:"until,unix"`
+	Day     time.Time `url:"day" layout:"2006-01-02"`
+	Active  *bool     `url:"active"`
+	Limit   *int      `url:"limit"`
+	Empty   string    `url:"empty,omitempty"`
+	Ignored string    `url:"-"`
+	Status  CustomStatus
+}
+
+type CustomStatus string
+
+func TestWithQueryParamsEscaping(t *testing.T) {
+	req := webtools.GetRequest("https://example.com/search?existing=1").
+		WithQueryParams(map[string]string{"q": "a b&c=ü"})
+
+	parsed, err := url.Parse(req.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Query().Get("q") != "a b&c=ü" || parsed.Query().Get("existing") != "1" {
+		t.Errorf("Expected escaped query parameters, got %s", req.Url)
+	}
+}
+
+func TestWithQueryValues(t *testing.T) {
+	req := webtools.GetRequest("https://example.com/").WithQueryValues(url.Values{"id": {"1", "2"}})
+
+	if req.Url != "https://example.com/?id=1&id=2" {
+		t.Errorf("Expected repeated keys, got %s", req.Url)
+	}
+}
+
+func TestWithQueryStruct(t *testing.T) {
+	active := true
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	req := webtools.GetRequest("https://example.com/").WithQueryStruct(&queryFilter{
+		queryPaging: queryPaging{Page: 2},
+		Search:      "go lang",
+		Tags:        []string{"a", "b"},
+		Fields:      []string{"id", "name"},
+		Since:       at,
+		Until:       at,
+		Day:         at,
+		Active:      &active,
+		Ignored:     "ignored",
+		Status:      "open",
+	})
+
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(req.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"page":   {"2"},
+		"q":      {"go lang"},
+		"tag":    {"a", "b"},
+		"fields": {"id,name"},
+		"since":  {"2024-05-01T12:30:00Z"},
+		"until":  {"1714566600"},
+		"day":    {"2024-05-01"},
+		"active": {"true"},
+		"Status": {"open"},
+	}
+
+	if parsed.Query().Encode() != expected.Encode() {
+		t.Errorf("Expected query\n%s\ngot\n%s", expected.Encode(), parsed.Query().Encode())
+	}
+}
+
+func TestWithQueryStructInvalid(t *testing.T) {
+	if err := webtools.GetRequest("https://example.com/").WithQueryStruct("not a struct").Validate(); err == nil {
+		t.Error("Expected an error for a non-struct value")
+	}
+}
+
+func TestWithQueryParamsBeforePathParams(t *testing.T) {
+	req := webtools.GetRequest("https://example.com/tenants/{tenant}/users#list").
+		WithQueryParams(map[string]string{"a": "b"}).
+		WithQueryValues(url.Values{"c": {"d"}}).
+		WithPathParam("tenant", "acme")
+
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Url != "https://example.com/tenants/acme/users?a=b&c=d#list" {
+		t.Errorf("Unexpected url %s", req.Url)
+	}
+}
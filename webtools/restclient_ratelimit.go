@@ -0,0 +1,287 @@
+package webtools
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimit struct {
+	// Sustained rate, zero for no rate limit
+	RequestsPerSecond float64
+
+	// Requests that may be sent at once after a quiet period, defaults to one
+	Burst int
+
+	// Requests that may be in flight at the same time, zero for no limit.
+	// A request is in flight until its response body is closed
+	MaxInFlight int
+}
+
+// RateLimiter delays requests with a token bucket per host or url prefix. Execute blocks until
+// the request is permitted or its context ends. Install it with RestClient.WithRateLimit or as
+// middleware on a request, share it between clients to share the limits
+type RateLimiter struct {
+	// Limit for hosts without a configured limit, nil for no limit
+	Default *RateLimit
+
+	// Pause a host when X-RateLimit-Remaining reaches zero until the time in X-RateLimit-Reset,
+	// and when a 429 response has a Retry-After header
+	AdaptToHeaders bool
+
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	mu          sync.Mutex
+	limit       RateLimit
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	inFlight    chan struct{}
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{}
+}
+
+// Limit requests to a host such as "api.example.com", or to urls starting with a prefix such as
+// "https://api.example.com/v2/". The longest matching prefix takes precedence over the host
+func (rl *RateLimiter) WithLimit(hostOrPrefix string, limit RateLimit) *RateLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.limits == nil {
+		rl.limits = map[string]RateLimit{}
+	}
+
+	rl.limits[hostOrPrefix] = limit
+	delete(rl.buckets, hostOrPrefix)
+
+	return rl
+}
+
+func (rl *RateLimiter) WithDefault(limit RateLimit) *RateLimiter {
+	rl.Default = &limit
+	return rl
+}
+
+// Add a rate limiter to the client, it runs as client middleware
+func (c *RestClient) WithRateLimit(limiter *RateLimiter) *RestClient {
+	return c.WithMiddleware(limiter.Middleware())
+}
+
+func (rl *RateLimiter) Middleware() Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*RestResponse, error) {
+			bucket := rl.bucket(req)
+			if bucket == nil {
+				return next.Do(req)
+			}
+
+			release, err := bucket.wait(req.Context())
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := next.Do(req)
+			if err != nil {
+				release()
+				return nil, err
+			}
+
+			if rl.AdaptToHeaders {
+				bucket.adapt(resp)
+			}
+
+			resp.Response.Body = &releaseOnClose{ReadCloser: resp.Response.Body, release: release}
+
+			return resp, nil
+		})
+	}
+}
+
+// The bucket for the longest matching prefix or the host, nil when the request is not limited
+func (rl *RateLimiter) bucket(req *http.Request) *rateBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rawUrl := req.URL.String()
+	key, limit, found := "", RateLimit{}, false
+
+	for prefix, l := range rl.limits {
+		if strings.Contains(prefix, "://") && strings.HasPrefix(rawUrl, prefix) && len(prefix) > len(key) {
+			key, limit, found = prefix, l, true
+		}
+	}
+
+	if !found {
+		host := req.URL.Hostname()
+
+		if l, ok := rl.limits[host]; ok {
+			key, limit, found = host, l, true
+		} else if l, ok := rl.limits[req.URL.Host]; ok {
+			key, limit, found = req.URL.Host, l, true
+		} else if rl.Default != nil {
+			key, limit, found = req.URL.Host, *rl.Default, true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	if rl.buckets == nil {
+		rl.buckets = map[string]*rateBucket{}
+	}
+
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = newRateBucket(limit)
+		rl.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+func newRateBucket(limit RateLimit) *rateBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	bucket := &rateBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+
+	if limit.MaxInFlight > 0 {
+		bucket.inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+
+	return bucket
+}
+
+// Block until a token and an in-flight slot are available, the returned function frees the slot
+func (b *rateBucket) wait(ctx context.Context) (func(), error) {
+	if b.inFlight != nil {
+		select {
+		case b.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		if b.inFlight != nil {
+			<-b.inFlight
+		}
+	}
+
+	for {
+		delay := b.reserve(time.Now())
+		if delay <= 0 {
+			return release, nil
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Take a token and return zero, or return how long to wait for the next token
+func (b *rateBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.pausedUntil) {
+		return b.pausedUntil.Sub(now)
+	}
+
+	rate := b.limit.RequestsPerSecond
+	if rate <= 0 {
+		return 0
+	}
+
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+func (b *rateBucket) adapt(resp *RestResponse) {
+	header := resp.Response.Header
+	until := time.Time{}
+
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil && remaining <= 0 {
+		if reset, ok := parseRateLimitReset(header.Get("X-RateLimit-Reset")); ok {
+			until = reset
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := RetryAfter(resp); ok {
+			until = time.Now().Add(delay)
+		}
+	}
+
+	if until.IsZero() {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Tokens are refilled from the end of the pause
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+		b.tokens = 0
+		b.last = until
+	}
+}
+
+// The reset header is either the unix time of the reset or the number of seconds until it
+func parseRateLimitReset(value string) (time.Time, bool) {
+	reset, err := strconv.ParseFloat(value, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}, false
+	}
+
+	if reset > 1e9 {
+		return time.Unix(0, int64(reset*float64(time.Second))), true
+	}
+
+	return time.Now().Add(time.Duration(reset * float64(time.Second))), true
+}
+
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *releaseOnClose) Close() error {
+	defer r.once.Do(r.release)
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,133 @@
+package webtools_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+	"github.com/scheiblingco/gofn/webtools/webtest"
+)
+
+func executeAll(t *testing.T, reqs ...*webtools.RestRequest) {
+	for _, req := range reqs {
+		resp, err := req.Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+}
+
+func TestRateLimitRequestsPerSecond(t *testing.T) {
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/other").Times(6)
+	srv.Expect(webtools.GET, "/limited/item").Times(6)
+
+	limiter := webtools.NewRateLimiter().WithLimit(srv.URL+"/limited/", webtools.RateLimit{RequestsPerSecond: 20, Burst: 2})
+	client := webtools.NewRestClient(srv.URL).WithRateLimit(limiter)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		executeAll(t, client.Get("/other"))
+	}
+
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected urls outside the prefix not to be limited, took %s", elapsed)
+	}
+
+	start = time.Now()
+	for i := 0; i < 6; i++ {
+		executeAll(t, client.Get("/limited/item"))
+	}
+
+	// Two requests use the burst, the other four wait 50ms each
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the requests to take about 200ms, took %s", elapsed)
+	}
+}
+
+func TestRateLimitMaxInFlight(t *testing.T) {
+	inFlight, maxInFlight := atomic.Int32{}, atomic.Int32{}
+
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}).Times(8)
+
+	limiter := webtools.NewRateLimiter().WithDefault(webtools.RateLimit{MaxInFlight: 2})
+	client := webtools.NewRestClient(srv.URL).WithRateLimit(limiter)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executeAll(t, client.Get("/"))
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight.Load() != 2 {
+		t.Errorf("Expected at most 2 concurrent requests, got %d", maxInFlight.Load())
+	}
+}
+
+func TestRateLimitContextExpires(t *testing.T) {
+	// The second request gives up before it is sent
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/")
+
+	limiter := webtools.NewRateLimiter().WithDefault(webtools.RateLimit{RequestsPerSecond: 0.1})
+	client := webtools.NewRestClient(srv.URL).WithRateLimit(limiter)
+
+	executeAll(t, client.Get("/"))
+
+	start := time.Now()
+	_, err := client.Get("/").WithTimeout(50 * time.Millisecond).Execute()
+
+	if !errors.As(err, &errtools.RequestTimeoutError{}) {
+		t.Errorf("Expected a timeout while waiting for the limiter, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the wait to end with the context, took %s", elapsed)
+	}
+}
+
+func TestRateLimitAdaptsToHeaders(t *testing.T) {
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/").
+		RespondWith(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "0.3")
+		}).
+		Respond(http.StatusOK, "").
+		Times(2)
+
+	limiter := webtools.NewRateLimiter().WithDefault(webtools.RateLimit{RequestsPerSecond: 1000, Burst: 10})
+	limiter.AdaptToHeaders = true
+
+	client := webtools.NewRestClient(srv.URL).WithRateLimit(limiter)
+
+	start := time.Now()
+	executeAll(t, client.Get("/"), client.Get("/"))
+
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("Expected the second request to wait for the reset, took %s", elapsed)
+	}
+}
@@ -0,0 +1,138 @@
+package webtools
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Retrier decides whether a failed attempt should be repeated and how long to wait before doing so.
+// Attempts are counted from 1, either resp or err is set
+type Retrier interface {
+	ShouldRetry(attempt int, req *RestRequest, resp *RestResponse, err error) (time.Duration, bool)
+}
+
+// RetryPolicy retries network errors and selected status codes with exponential backoff and jitter,
+// a Retry-After header sent by the server takes precedence over the computed backoff. A response
+// that asks to wait longer than MaxBackoff is returned without retrying
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Fraction (0-1) of the backoff that is randomized
+	Jitter float64
+
+	RetryStatusCodes   []int
+	RetryNetworkErrors bool
+
+	// Methods that are retried, defaults to the idempotent methods when empty
+	RetryMethods []RequestMethod
+}
+
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+var IdempotentMethods = []RequestMethod{GET, HEAD, OPTIONS, PUT, DELETE}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:        3,
+		InitialBackoff:     200 * time.Millisecond,
+		MaxBackoff:         10 * time.Second,
+		Multiplier:         2,
+		Jitter:             0.2,
+		RetryStatusCodes:   DefaultRetryStatusCodes,
+		RetryNetworkErrors: true,
+	}
+}
+
+func (p *RetryPolicy) ShouldRetry(attempt int, req *RestRequest, resp *RestResponse, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	methods := p.RetryMethods
+	if len(methods) == 0 {
+		methods = IdempotentMethods
+	}
+
+	if !slices.Contains(methods, req.Method) {
+		return 0, false
+	}
+
+	if err != nil {
+		return p.Backoff(attempt), p.RetryNetworkErrors && isRetryableError(err)
+	}
+
+	if !slices.Contains(p.RetryStatusCodes, resp.StatusCode) {
+		return 0, false
+	}
+
+	if delay, ok := RetryAfter(resp); ok {
+		if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+			return 0, false
+		}
+
+		return delay, true
+	}
+
+	return p.Backoff(attempt), true
+}
+
+// Backoff returns the delay after the given attempt
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		backoff -= backoff * p.Jitter * rand.Float64()
+	}
+
+	return time.Duration(backoff)
+}
+
+// Parse the Retry-After header of a response, either as seconds or as an http date
+func RetryAfter(resp *RestResponse) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := http.Header(resp.Headers).Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// Transport errors are retryable, errors from a request that could not be built are not
+func isRetryableError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Op != "parse"
+}
@@ -0,0 +1,113 @@
+package webtools_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+func flakyServer(t *testing.T, failures int, attempts *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*attempts++
+
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodGet && string(body) != `{"name":"test"}` {
+			t.Errorf("Expected body to be replayed on attempt %d, got %q", *attempts, string(body))
+		}
+
+		if *attempts <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func testRetryPolicy() *webtools.RetryPolicy {
+	policy := webtools.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	return policy
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	attempts := 0
+	srv := flakyServer(t, 2, &attempts)
+	defer srv.Close()
+
+	resp, err := webtools.PutRequest(srv.URL).
+		WithJsonBody(map[string]string{"name": "test"}, nil).
+		WithRetry(testRetryPolicy()).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusOK || attempts != 3 {
+		t.Errorf("Expected status 200 after 3 attempts, got %d after %d", resp.StatusCode, attempts)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	attempts := 0
+	srv := flakyServer(t, 5, &attempts)
+	defer srv.Close()
+
+	resp, err := webtools.NewRestClient(srv.URL).WithRetry(testRetryPolicy()).Get("/").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || attempts != 3 {
+		t.Errorf("Expected status 503 after 3 attempts, got %d after %d", resp.StatusCode, attempts)
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	attempts := 0
+	srv := flakyServer(t, 2, &attempts)
+	defer srv.Close()
+
+	resp, err := webtools.PostRequest(srv.URL).
+		WithJsonBody(map[string]string{"name": "test"}, nil).
+		WithRetry(testRetryPolicy()).
+		Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if attempts != 1 {
+		t.Errorf("Expected POST not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	resp := &webtools.RestResponse{Headers: map[string][]string{"Retry-After": {"3"}}}
+
+	if delay, ok := webtools.RetryAfter(resp); !ok || delay != 3*time.Second {
+		t.Errorf("Expected Retry-After of 3s, got %v", delay)
+	}
+}
+
+func TestRetryAfterBeyondMaxBackoff(t *testing.T) {
+	req := webtools.GetRequest("http://localhost")
+	resp := &webtools.RestResponse{StatusCode: http.StatusServiceUnavailable, Headers: map[string][]string{"Retry-After": {"86400"}}}
+
+	if delay, retry := webtools.DefaultRetryPolicy().ShouldRetry(1, req, resp, nil); retry {
+		t.Errorf("Expected a Retry-After beyond MaxBackoff not to be retried, got a delay of %v", delay)
+	}
+
+	resp.Headers["Retry-After"] = []string{"1"}
+
+	if delay, retry := webtools.DefaultRetryPolicy().ShouldRetry(1, req, resp, nil); !retry || delay != time.Second {
+		t.Errorf("Expected a retry after 1s, got %v (%t)", delay, retry)
+	}
+}
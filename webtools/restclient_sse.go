@@ -0,0 +1,282 @@
+package webtools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"iter"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+// Reconnection delay used until the server sends a retry field
+var DefaultEventRetryInterval = 3 * time.Second
+
+// Longest line accepted in an event stream unless EventStreamOptions.MaxLineSize is set
+var DefaultMaxEventLineSize = 1 << 20
+
+// ServerSentEvent is an event received from a text/event-stream response
+type ServerSentEvent struct {
+	// The last event id sent by the server, it is kept for following events
+	Id string
+
+	// Event type, "message" when the server did not set one
+	Event string
+
+	// Data lines of the event joined with newlines
+	Data string
+
+	// Reconnection time sent with the event, zero when not set
+	Retry time.Duration
+}
+
+type EventStreamOptions struct {
+	// Sent as Last-Event-ID on the first connection
+	LastEventId string
+
+	// Delay before reconnecting until the server sets one, DefaultEventRetryInterval when zero
+	RetryInterval time.Duration
+
+	// Consecutive failed connection attempts before giving up, zero for no limit
+	MaxReconnects int
+
+	// Stop when the stream ends instead of reconnecting
+	DisableReconnect bool
+
+	// Longest accepted line, DefaultMaxEventLineSize when zero
+	MaxLineSize int
+}
+
+// Iterate over the events sent in response to req, which is sent with the headers and authorization
+// set on it. When the stream ends or fails the request is sent again after the retry interval with the
+// id of the last event as Last-Event-ID. A 204 response ends the iteration, other client errors and
+// responses that are not an event stream end it with an error
+func Events(ctx context.Context, req *RestRequest, opts *EventStreamOptions) iter.Seq2[ServerSentEvent, error] {
+	if opts == nil {
+		opts = &EventStreamOptions{}
+	}
+
+	return func(yield func(ServerSentEvent, error) bool) {
+		stream := &eventStream{
+			lastEventId: opts.LastEventId,
+			retry:       opts.RetryInterval,
+		}
+
+		if stream.retry <= 0 {
+			stream.retry = DefaultEventRetryInterval
+		}
+
+		failures := 0
+
+		for {
+			connected, done, err := stream.connect(ctx, req, opts, yield)
+			if done {
+				return
+			}
+
+			if connected {
+				failures = 0
+			} else {
+				failures++
+			}
+
+			if err == nil && opts.DisableReconnect {
+				return
+			}
+
+			if err != nil && (opts.DisableReconnect || (opts.MaxReconnects > 0 && failures > opts.MaxReconnects)) {
+				yield(ServerSentEvent{}, err)
+				return
+			}
+
+			select {
+			case <-time.After(stream.retry):
+			case <-ctx.Done():
+				yield(ServerSentEvent{}, req.wrapError(ctx, ctx.Err()))
+				return
+			}
+		}
+	}
+}
+
+// Deliver the events of Events over a channel. The events channel is closed when the stream ends,
+// the error that ended it is sent on the buffered error channel first
+func EventChannel(ctx context.Context, req *RestRequest, opts *EventStreamOptions) (<-chan ServerSentEvent, <-chan error) {
+	events := make(chan ServerSentEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(events)
+
+		for event, err := range Events(ctx, req, opts) {
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+type eventStream struct {
+	lastEventId string
+	retry       time.Duration
+}
+
+// Read events from one connection. connected reports whether the server accepted the stream,
+// done that the iteration has ended and err why the connection was lost
+func (s *eventStream) connect(ctx context.Context, req *RestRequest, opts *EventStreamOptions, yield func(ServerSentEvent, error) bool) (connected, done bool, err error) {
+	streamReq := req.Clone().
+		WithHeader("Accept", "text/event-stream").
+		WithHeader("Cache-Control", "no-cache")
+
+	if s.lastEventId != "" {
+		streamReq = streamReq.WithHeader("Last-Event-ID", s.lastEventId)
+	}
+
+	resp, err := streamReq.ExecuteContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			yield(ServerSentEvent{}, err)
+			return false, true, err
+		}
+
+		return false, false, err
+	}
+	defer resp.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return false, true, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		resp.discard()
+		return false, false, resp.statusError(nil)
+	case !resp.IsSuccess():
+		yield(ServerSentEvent{}, resp.StatusError())
+		return false, true, nil
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(resp.Response.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		yield(ServerSentEvent{}, errtools.InvalidTypeError("expected an event stream, got "+resp.Response.Header.Get("Content-Type")))
+		return true, true, nil
+	}
+
+	maxLineSize := opts.MaxLineSize
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxEventLineSize
+	}
+
+	resp.bodyRead = true
+
+	scanner := bufio.NewScanner(resp.Response.Body)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	scanner.Split(scanEventLines)
+
+	event := ServerSentEvent{}
+	data := strings.Builder{}
+	first := true
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if line == "" {
+			if data.Len() == 0 {
+				event = ServerSentEvent{}
+				continue
+			}
+
+			event.Id = s.lastEventId
+			event.Data = strings.TrimSuffix(data.String(), "\n")
+			if event.Event == "" {
+				event.Event = "message"
+			}
+
+			if !yield(event, nil) {
+				return true, true, nil
+			}
+
+			event = ServerSentEvent{}
+			data.Reset()
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventId = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+				event.Retry = s.retry
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		yield(ServerSentEvent{}, req.wrapError(ctx, ctx.Err()))
+		return true, true, nil
+	}
+
+	// An incomplete event at the end of the stream is discarded
+	return true, false, scanner.Err()
+}
+
+// Split lines ending in CRLF, LF or CR
+func scanEventLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+
+		// A CR at the end of the buffer may be followed by a LF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
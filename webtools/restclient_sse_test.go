@@ -0,0 +1,147 @@
+package webtools_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+	"github.com/scheiblingco/gofn/webtools/webtest"
+)
+
+func TestEvents(t *testing.T) {
+	srv := webtest.NewServer(t).InOrder()
+
+	// The stream ends without a complete last event and is resumed from the last id,
+	// the third connection ends the stream with 204 No Content
+	srv.Expect(webtools.GET, "/").
+		WithHeader("Authorization", "Bearer secret").
+		WithHeader("Accept", "text/event-stream").
+		WithHeader("Last-Event-ID", "0").
+		RespondWith(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			io.WriteString(w, "\ufeff: comment\r\nretry: 10\r\n\r\n")
+			w.(http.Flusher).Flush()
+			io.WriteString(w, "data: first\ndata:second line\n\nevent: update\nid: 1\ndata: {\"a\":1}\n\r")
+			io.WriteString(w, "id: 2\n\ndata: incomplete")
+		})
+
+	srv.Expect(webtools.GET, "/").
+		WithHeader("Authorization", "Bearer secret").
+		WithHeader("Accept", "text/event-stream").
+		WithHeader("Last-Event-ID", "2").
+		RespondWith(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: after reconnect\n\n")
+		}).
+		Respond(http.StatusNoContent, "").
+		Times(2)
+
+	req := webtools.GetRequest(srv.URL).WithAuthorization(&webtools.BearerToken{Token: "secret"})
+
+	expected := []webtools.ServerSentEvent{
+		{Event: "message", Id: "0", Data: "first\nsecond line"},
+		{Event: "update", Id: "1", Data: `{"a":1}`},
+		{Event: "message", Id: "2", Data: "after reconnect"},
+	}
+
+	events := []webtools.ServerSentEvent{}
+
+	for event, err := range webtools.Events(context.Background(), req, &webtools.EventStreamOptions{LastEventId: "0"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, event)
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("Event %d: expected %+v, got %+v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestEventsErrors(t *testing.T) {
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/missing").Respond(http.StatusNotFound, "")
+	srv.Expect(webtools.GET, "/json").RespondJSON(http.StatusOK, map[string]any{})
+
+	// The first attempt and two reconnects before giving up
+	srv.Expect(webtools.GET, "/unavailable").Respond(http.StatusServiceUnavailable, "").Times(3)
+
+	opts := &webtools.EventStreamOptions{RetryInterval: time.Millisecond, MaxReconnects: 2}
+
+	tests := []struct {
+		path  string
+		check func(err error) bool
+	}{
+		{"/missing", func(err error) bool {
+			statusErr := errtools.HTTPStatusError{}
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+		}},
+		{"/json", func(err error) bool {
+			return errors.As(err, new(errtools.InvalidTypeError))
+		}},
+		{"/unavailable", func(err error) bool {
+			statusErr := errtools.HTTPStatusError{}
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusServiceUnavailable
+		}},
+	}
+
+	for _, test := range tests {
+		var last error
+		count := 0
+
+		for _, err := range webtools.Events(context.Background(), webtools.GetRequest(srv.URL+test.path), opts) {
+			last = err
+			count++
+		}
+
+		if count != 1 || !test.check(last) {
+			t.Errorf("%s: unexpected result after %d values: %v", test.path, count, last)
+		}
+	}
+}
+
+func TestEventChannel(t *testing.T) {
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, data := range []string{"one", "two"} {
+			io.WriteString(w, "data: "+data+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, errs := webtools.EventChannel(ctx, webtools.GetRequest(srv.URL), nil)
+
+	for _, expected := range []string{"one", "two"} {
+		if event := <-events; event.Data != expected {
+			t.Errorf("Expected %q, got %q", expected, event.Data)
+		}
+	}
+
+	cancel()
+
+	for range events {
+	}
+
+	if err := <-errs; !errors.As(err, new(errtools.RequestCanceledError)) {
+		t.Errorf("Expected the stream to end with a canceled error, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package webtools_test
 import (
 	"fmt"
 	"maps"
+	"os"
 	"testing"
 
 	"github.com/scheiblingco/gofn/webtools"
@@ -15,6 +16,27 @@ type ResponseBody struct {
 	URL     string            `json:"url"`
 }
 
+// Tests against external services replay their cassette from testdata/cassettes,
+// set GOFN_RECORD=1 to send the requests and record the cassettes again. Tests
+// without a recorded cassette are skipped
+func cassetteClient(t *testing.T, name string) *webtools.RestClient {
+	path := "testdata/cassettes/" + name + ".yaml"
+
+	mode := webtools.CassetteReplay
+	if os.Getenv("GOFN_RECORD") != "" {
+		mode = webtools.CassetteRecord
+	} else if _, err := os.Stat(path); os.IsNotExist(err) {
+		t.Skipf("Cassette %s has not been recorded, run with GOFN_RECORD=1", path)
+	}
+
+	cassette, err := webtools.NewCassette(path, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return webtools.NewRestClient("", cassette)
+}
+
 func TestGetRequest(t *testing.T) {
 	t.Log("Testing GET request")
 
@@ -28,7 +50,7 @@ func TestGetRequest(t *testing.T) {
 		"key2": "value2",
 	}
 
-	resp, err := webtools.GetRequest("https://httpbin.org/get").
+	resp, err := cassetteClient(t, "httpbin_get").Get("https://httpbin.org/get").
 		WithHeader("Accept", expectedHeaders["Accept"]).
 		WithHeaders(map[string]string{
 			"User-Agent": expectedHeaders["User-Agent"],
@@ -36,7 +58,7 @@ func TestGetRequest(t *testing.T) {
 		WithQueryParams(expectedArgs).Execute()
 
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 
 	bodyObj := &ResponseBody{}
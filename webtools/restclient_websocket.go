@@ -0,0 +1,485 @@
+package webtools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/scheiblingco/gofn/errtools"
+)
+
+type WebSocketMessageType int
+
+const (
+	WebSocketText   WebSocketMessageType = websocket.TextMessage
+	WebSocketBinary WebSocketMessageType = websocket.BinaryMessage
+)
+
+type WebSocketMessage struct {
+	Type WebSocketMessageType
+	Data []byte
+}
+
+type WebSocketOptions struct {
+	// Subprotocols offered in the handshake
+	Subprotocols []string
+
+	// Interval between pings sent to the server, zero disables the keep-alive
+	PingInterval time.Duration
+
+	// Time to wait for the answer to a ping before the connection is lost, defaults to PingInterval
+	PongTimeout time.Duration
+
+	// Reconnect when the connection is lost, nil to end the message stream instead. Backoff sets the
+	// delay before each attempt and MaxAttempts the consecutive failed attempts, zero for no limit
+	Reconnect *RetryPolicy
+
+	// Called after a lost connection was replaced, for example to subscribe again
+	OnReconnect func(ws *WebSocket)
+
+	// Time to wait for the server to answer the close frame, defaults to 5 seconds
+	CloseTimeout time.Duration
+
+	// Largest message accepted from the server, zero for no limit
+	MaxMessageSize int64
+}
+
+// WebSocket is a client connection that keeps reading messages in the background. Messages can
+// be written while another goroutine reads them
+type WebSocket struct {
+	req    *RestRequest
+	opts   WebSocketOptions
+	dialer *websocket.Dialer
+
+	// Bounds the handshakes when reconnecting, canceled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	closing bool
+
+	writeMu sync.Mutex
+
+	messages chan WebSocketMessage
+	closed   chan struct{}
+	stopped  chan struct{}
+
+	// Why the message stream ended, set before messages is closed
+	err error
+}
+
+// Open a WebSocket connection to the url of req, http and https urls are dialed as ws and wss.
+// The headers and authorization of the request are sent with the handshake, the TLS configuration,
+// proxy and cookie jar are taken from the http.Client of its RestClient. Middleware is not applied.
+// ctx bounds the handshake, the connection stays open until Close is called
+func DialWebSocket(ctx context.Context, req *RestRequest, opts *WebSocketOptions) (*WebSocket, error) {
+	if opts == nil {
+		opts = &WebSocketOptions{}
+	}
+
+	ws := &WebSocket{
+		req:      req.Clone().withMethod(GET),
+		opts:     *opts,
+		dialer:   req.websocketDialer(opts),
+		messages: make(chan WebSocketMessage),
+		closed:   make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	conn, err := ws.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ws.conn = conn
+	ws.ctx, ws.cancel = context.WithCancel(context.Background())
+
+	go ws.readLoop(conn)
+
+	if ws.opts.PingInterval > 0 {
+		go ws.pingLoop()
+	}
+
+	return ws, nil
+}
+
+// Open a WebSocket connection to the path relative to the base url, see DialWebSocket
+func (c *RestClient) DialWebSocket(ctx context.Context, path string, opts *WebSocketOptions) (*WebSocket, error) {
+	return DialWebSocket(ctx, c.Get(path), opts)
+}
+
+// Wait for the next message. After the stream ended the error is returned, an
+// errtools.WebSocketClosedError when the connection was closed by either side
+func (ws *WebSocket) ReadMessage(ctx context.Context) (WebSocketMessage, error) {
+	select {
+	case message, ok := <-ws.messages:
+		if !ok {
+			return WebSocketMessage{}, ws.err
+		}
+
+		return message, nil
+	case <-ctx.Done():
+		return WebSocketMessage{}, ws.req.wrapError(ctx, ctx.Err())
+	}
+}
+
+// Read the next message into v
+func (ws *WebSocket) ReadJSON(ctx context.Context, v interface{}) error {
+	message, err := ws.ReadMessage(ctx)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(message.Data, v)
+}
+
+// Received messages, the channel is closed when the stream ends and Err returns why
+func (ws *WebSocket) Messages() <-chan WebSocketMessage {
+	return ws.messages
+}
+
+// Why the message stream ended, nil while it is open
+func (ws *WebSocket) Err() error {
+	select {
+	case <-ws.stopped:
+		return ws.err
+	default:
+		return nil
+	}
+}
+
+// The subprotocol selected by the server
+func (ws *WebSocket) Subprotocol() string {
+	return ws.current().Subprotocol()
+}
+
+// Writes fail while the connection is lost, also when it is being reconnected
+func (ws *WebSocket) WriteMessage(messageType WebSocketMessageType, data []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.isClosing() {
+		return errtools.WebSocketClosedError{Code: websocket.CloseNormalClosure}
+	}
+
+	return ws.current().WriteMessage(int(messageType), data)
+}
+
+func (ws *WebSocket) WriteText(text string) error {
+	return ws.WriteMessage(WebSocketText, []byte(text))
+}
+
+func (ws *WebSocket) WriteBinary(data []byte) error {
+	return ws.WriteMessage(WebSocketBinary, data)
+}
+
+// Write v as a json text message
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ws.WriteMessage(WebSocketText, data)
+}
+
+// Close the connection gracefully by sending a close frame and waiting for the server to answer
+// it, the message stream ends with an errtools.WebSocketClosedError
+func (ws *WebSocket) Close() error {
+	ws.mu.Lock()
+	if ws.closing {
+		ws.mu.Unlock()
+		return nil
+	}
+
+	ws.closing = true
+	conn := ws.conn
+	ws.mu.Unlock()
+
+	close(ws.closed)
+	ws.cancel()
+
+	timeout := ws.opts.CloseTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(timeout))
+	if err == nil {
+		select {
+		case <-ws.stopped:
+		case <-time.After(timeout):
+		}
+	}
+
+	conn.Close()
+	<-ws.stopped
+
+	// The connection was already lost or closed by the server
+	if errors.Is(err, websocket.ErrCloseSent) || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (ws *WebSocket) dial(ctx context.Context) (*websocket.Conn, error) {
+	req := ws.req.Clone()
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	if req.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.timeout)
+		defer cancel()
+	}
+
+	conn, resp, err := ws.handshake(ctx, req)
+	if err != nil || conn != nil {
+		return conn, err
+	}
+
+	// Answer a single authorization challenge like RestRequest.Execute
+	if challenger, ok := req.auth.(ChallengeAuthorization); ok && resp.StatusCode == http.StatusUnauthorized {
+		retry, err := challenger.Challenge(req, resp)
+		if err != nil {
+			resp.discard()
+			return nil, err
+		}
+
+		if retry {
+			resp.discard()
+
+			conn, resp, err = ws.handshake(ctx, req)
+			if err != nil || conn != nil {
+				return conn, err
+			}
+		}
+	}
+
+	body, _ := resp.readBody(int64(MaxErrorBodySize))
+
+	return nil, resp.statusError(body)
+}
+
+// Send the handshake, the response is returned when the server did not upgrade the connection
+func (ws *WebSocket) handshake(ctx context.Context, req *RestRequest) (*websocket.Conn, *RestResponse, error) {
+	if err := req.applyAuth(ctx); err != nil {
+		return nil, nil, req.wrapError(ctx, err)
+	}
+
+	target, err := url.Parse(websocketUrl(req.Url))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.addAuthQuery(target)
+
+	conn, resp, err := ws.dialer.DialContext(ctx, target.String(), req.effectiveHeader())
+	if err != nil {
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return nil, NewRestResponse(resp), nil
+		}
+
+		return nil, nil, req.wrapError(ctx, err)
+	}
+
+	if ws.opts.MaxMessageSize > 0 {
+		conn.SetReadLimit(ws.opts.MaxMessageSize)
+	}
+
+	if ws.opts.PingInterval > 0 {
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(ws.readDeadline())
+		})
+	}
+
+	return conn, nil, nil
+}
+
+func (ws *WebSocket) readLoop(conn *websocket.Conn) {
+	defer close(ws.messages)
+	defer close(ws.stopped)
+
+	for {
+		err := ws.readMessages(conn)
+
+		if ws.opts.Reconnect == nil || ws.isClosing() || websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			conn.Close()
+			ws.err = ws.closedError(err)
+			return
+		}
+
+		conn.Close()
+
+		if conn, err = ws.reconnect(); err != nil {
+			ws.err = err
+			return
+		}
+
+		if ws.opts.OnReconnect != nil {
+			ws.opts.OnReconnect(ws)
+		}
+	}
+}
+
+// Deliver messages until reading from the connection fails
+func (ws *WebSocket) readMessages(conn *websocket.Conn) error {
+	for {
+		// Without reads the deadline is extended by the time spent waiting for the caller
+		if ws.opts.PingInterval > 0 {
+			conn.SetReadDeadline(ws.readDeadline())
+		}
+
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case ws.messages <- WebSocketMessage{Type: WebSocketMessageType(messageType), Data: data}:
+		case <-ws.closed:
+			return errtools.WebSocketClosedError{Code: websocket.CloseNormalClosure}
+		}
+	}
+}
+
+func (ws *WebSocket) reconnect() (*websocket.Conn, error) {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-time.After(ws.opts.Reconnect.Backoff(attempt)):
+		case <-ws.closed:
+			return nil, errtools.WebSocketClosedError{Code: websocket.CloseNormalClosure}
+		}
+
+		conn, err := ws.dial(ws.ctx)
+		if err != nil {
+			if ws.isClosing() {
+				return nil, errtools.WebSocketClosedError{Code: websocket.CloseNormalClosure}
+			}
+
+			if ws.opts.Reconnect.MaxAttempts > 0 && attempt >= ws.opts.Reconnect.MaxAttempts {
+				return nil, err
+			}
+
+			continue
+		}
+
+		ws.mu.Lock()
+		closing := ws.closing
+		if !closing {
+			ws.conn = conn
+		}
+		ws.mu.Unlock()
+
+		if closing {
+			conn.Close()
+			return nil, errtools.WebSocketClosedError{Code: websocket.CloseNormalClosure}
+		}
+
+		return conn, nil
+	}
+}
+
+func (ws *WebSocket) pingLoop() {
+	ticker := time.NewTicker(ws.opts.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// A failed ping is noticed by the read loop when the pong does not arrive
+			ws.current().WriteControl(websocket.PingMessage, nil, time.Now().Add(ws.pongTimeout()))
+		case <-ws.stopped:
+			return
+		}
+	}
+}
+
+func (ws *WebSocket) readDeadline() time.Time {
+	return time.Now().Add(ws.opts.PingInterval + ws.pongTimeout())
+}
+
+func (ws *WebSocket) pongTimeout() time.Duration {
+	if ws.opts.PongTimeout <= 0 {
+		return ws.opts.PingInterval
+	}
+
+	return ws.opts.PongTimeout
+}
+
+func (ws *WebSocket) current() *websocket.Conn {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.conn
+}
+
+func (ws *WebSocket) isClosing() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.closing
+}
+
+func (ws *WebSocket) closedError(err error) error {
+	closeErr := &websocket.CloseError{}
+	if errors.As(err, &closeErr) {
+		return errtools.WebSocketClosedError{Code: closeErr.Code, Text: closeErr.Text}
+	}
+
+	if ws.isClosing() {
+		return errtools.WebSocketClosedError{Code: websocket.CloseNormalClosure}
+	}
+
+	return err
+}
+
+// A dialer using the TLS configuration, proxy and cookie jar of the request's http.Client
+func (r *RestRequest) websocketDialer(opts *WebSocketOptions) *websocket.Dialer {
+	client := r.client.httpClient()
+
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		Subprotocols:     opts.Subprotocols,
+		Jar:              client.Jar,
+	}
+
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if t, ok := transport.(*http.Transport); ok {
+		dialer.Proxy = t.Proxy
+		dialer.NetDialContext = t.DialContext
+		dialer.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+
+	if client.Timeout > 0 {
+		dialer.HandshakeTimeout = client.Timeout
+	}
+
+	return dialer
+}
+
+func websocketUrl(rawUrl string) string {
+	switch {
+	case strings.HasPrefix(rawUrl, "http://"):
+		return "ws://" + strings.TrimPrefix(rawUrl, "http://")
+	case strings.HasPrefix(rawUrl, "https://"):
+		return "wss://" + strings.TrimPrefix(rawUrl, "https://")
+	}
+
+	return rawUrl
+}
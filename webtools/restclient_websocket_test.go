@@ -0,0 +1,286 @@
+package webtools_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+var upgrader = websocket.Upgrader{Subprotocols: []string{"echo"}}
+
+func websocketHandler(handle func(conn *websocket.Conn, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		handle(conn, r)
+	})
+}
+
+// Echo messages until the connection fails, the error is sent on errs
+func echo(conn *websocket.Conn, errs chan<- error) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if errs != nil {
+				errs <- err
+			}
+			return
+		}
+
+		conn.WriteMessage(messageType, data)
+	}
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	serverErrs := make(chan error, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Client") != "gofn" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("missing credentials"))
+			return
+		}
+
+		websocketHandler(func(conn *websocket.Conn, r *http.Request) { echo(conn, serverErrs) }).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	_, err := webtools.NewRestClient(srv.URL).DialWebSocket(context.Background(), "/ws", nil)
+
+	statusErr := errtools.HTTPStatusError{}
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized || string(statusErr.Body) != "missing credentials" {
+		t.Fatalf("Expected the rejected handshake to return the status, got %v", err)
+	}
+
+	client := webtools.NewRestClient(srv.URL).
+		WithAuthorization(&webtools.BearerToken{Token: "secret"}).
+		WithHeader("X-Client", "gofn")
+
+	ws, err := client.DialWebSocket(context.Background(), "/ws", &webtools.WebSocketOptions{Subprotocols: []string{"echo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ws.Subprotocol() != "echo" {
+		t.Errorf("Expected the echo subprotocol, got %q", ws.Subprotocol())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := ws.WriteText("hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if message, err := ws.ReadMessage(ctx); err != nil || message.Type != webtools.WebSocketText || string(message.Data) != "hello" {
+		t.Errorf("Expected the text message back, got %+v (%v)", message, err)
+	}
+
+	if err := ws.WriteBinary([]byte{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if message, err := ws.ReadMessage(ctx); err != nil || message.Type != webtools.WebSocketBinary || len(message.Data) != 3 {
+		t.Errorf("Expected the binary message back, got %+v (%v)", message, err)
+	}
+
+	type payload struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	if err := ws.WriteJSON(payload{Name: "gofn", Count: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := payload{}
+	if err := ws.ReadJSON(ctx, &received); err != nil || received.Name != "gofn" || received.Count != 2 {
+		t.Errorf("Expected the json message back, got %+v (%v)", received, err)
+	}
+
+	if err := ws.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !websocket.IsCloseError(<-serverErrs, websocket.CloseNormalClosure) {
+		t.Error("Expected the server to receive a normal close frame")
+	}
+
+	closedErr := errtools.WebSocketClosedError{}
+	if _, err := ws.ReadMessage(ctx); !errors.As(err, &closedErr) || closedErr.Code != websocket.CloseNormalClosure {
+		t.Errorf("Expected a closed error after Close, got %v", err)
+	}
+
+	if err := ws.WriteText("after close"); !errors.As(err, &closedErr) {
+		t.Errorf("Expected writing after Close to fail, got %v", err)
+	}
+}
+
+func TestWebSocketClientCertificate(t *testing.T) {
+	srv := httptest.NewUnstartedServer(websocketHandler(func(conn *websocket.Conn, r *http.Request) {
+		conn.WriteMessage(websocket.TextMessage, []byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		echo(conn, nil)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert := clientCertificate(t, "gofn-client")
+
+	// The server certificate is trusted through the test server's client
+	client := webtools.NewRestClient(srv.URL).WithHttpClient(srv.Client())
+	opt := webtools.WithClientCertificate(cert)
+	opt.Apply(client.HttpClient)
+
+	ws, err := client.DialWebSocket(context.Background(), "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if message, err := ws.ReadMessage(ctx); err != nil || string(message.Data) != "gofn-client" {
+		t.Errorf("Expected the server to see the client certificate, got %q (%v)", message.Data, err)
+	}
+}
+
+func TestWebSocketReconnect(t *testing.T) {
+	connections := &atomic.Int32{}
+
+	srv := httptest.NewServer(websocketHandler(func(conn *websocket.Conn, r *http.Request) {
+		if connections.Add(1) == 1 {
+			// Drop the connection without a close frame
+			conn.WriteMessage(websocket.TextMessage, []byte("first"))
+			conn.NetConn().Close()
+			return
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte("second"))
+		echo(conn, nil)
+	}))
+	defer srv.Close()
+
+	reconnects := &atomic.Int32{}
+
+	ws, err := webtools.DialWebSocket(context.Background(), webtools.GetRequest(srv.URL), &webtools.WebSocketOptions{
+		Reconnect:   &webtools.RetryPolicy{InitialBackoff: time.Millisecond},
+		OnReconnect: func(ws *webtools.WebSocket) { reconnects.Add(1) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, expected := range []string{"first", "second"} {
+		if message, err := ws.ReadMessage(ctx); err != nil || string(message.Data) != expected {
+			t.Fatalf("Expected %q, got %q (%v)", expected, message.Data, err)
+		}
+	}
+
+	if err := ws.WriteText("still there"); err != nil {
+		t.Fatal(err)
+	}
+
+	if message, err := ws.ReadMessage(ctx); err != nil || string(message.Data) != "still there" {
+		t.Errorf("Expected the reconnected connection to echo, got %q (%v)", message.Data, err)
+	}
+
+	if connections.Load() != 2 || reconnects.Load() != 1 {
+		t.Errorf("Expected a single reconnect, got %d connections and %d reconnects", connections.Load(), reconnects.Load())
+	}
+}
+
+func TestWebSocketKeepAlive(t *testing.T) {
+	pings := &atomic.Int32{}
+
+	srv := httptest.NewServer(websocketHandler(func(conn *websocket.Conn, r *http.Request) {
+		if r.URL.Path == "/unresponsive" {
+			// Never reads, so pings are not answered
+			<-r.Context().Done()
+			return
+		}
+
+		conn.SetPingHandler(func(data string) error {
+			pings.Add(1)
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+
+		echo(conn, nil)
+	}))
+	defer srv.Close()
+
+	opts := &webtools.WebSocketOptions{PingInterval: 10 * time.Millisecond, PongTimeout: 50 * time.Millisecond}
+
+	ws, err := webtools.DialWebSocket(context.Background(), webtools.GetRequest(srv.URL+"/alive"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	time.Sleep(150 * time.Millisecond)
+
+	if pings.Load() < 2 || ws.Err() != nil {
+		t.Errorf("Expected pings to keep the connection open, got %d pings (%v)", pings.Load(), ws.Err())
+	}
+
+	ws, err = webtools.DialWebSocket(context.Background(), webtools.GetRequest(srv.URL+"/unresponsive"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var netErr net.Error
+	if _, err := ws.ReadMessage(ctx); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Expected the missing pongs to time out the connection, got %v", err)
+	}
+}
+
+func clientCertificate(t *testing.T, commonName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
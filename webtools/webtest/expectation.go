@@ -0,0 +1,268 @@
+package webtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+// Expectation describes a request the server expects and how it responds to it.
+// Unless Times or AnyTimes is used the request is expected exactly once
+type Expectation struct {
+	Method  webtools.RequestMethod
+	Pattern string
+
+	header   http.Header
+	query    map[string][]string
+	body     *[]byte
+	jsonBody any
+
+	min, max       int
+	delay          time.Duration
+	responses      []*response
+	responseHeader http.Header
+
+	mu    sync.Mutex
+	calls int
+	index int
+}
+
+type response struct {
+	status  int
+	header  http.Header
+	body    []byte
+	handler http.HandlerFunc
+	fail    bool
+}
+
+// A header value the request must contain
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// A query parameter value the request must contain
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query[key] = append(e.query[key], value)
+	return e
+}
+
+// The exact request body
+func (e *Expectation) WithBody(body string) *Expectation {
+	b := []byte(body)
+	e.body = &b
+	return e
+}
+
+// A json request body, compared without regard to formatting and key order
+func (e *Expectation) WithJSONBody(v any) *Expectation {
+	e.jsonBody = v
+	return e
+}
+
+// Expect the request n times
+func (e *Expectation) Times(n int) *Expectation {
+	e.min, e.max = n, n
+	return e
+}
+
+// Allow the request any number of times, including never
+func (e *Expectation) AnyTimes() *Expectation {
+	e.min, e.max = 0, -1
+	return e
+}
+
+// Wait before responding, the wait ends early when the client gives up on the request
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Add a header to every response
+func (e *Expectation) WithResponseHeader(key, value string) *Expectation {
+	e.responseHeader.Add(key, value)
+	return e
+}
+
+// Respond with the status and body. Each Respond call adds a response that is used for
+// one call in order, the last response is repeated for further calls
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	return e.addResponse(&response{status: status, body: []byte(body)})
+}
+
+// Respond with the status and v encoded as json
+func (e *Expectation) RespondJSON(status int, v any) *Expectation {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("webtest: cannot encode response for %s %s: %v", e.Method, e.Pattern, err))
+	}
+
+	resp := &response{status: status, body: body, header: http.Header{}}
+	resp.header.Set("Content-Type", "application/json")
+
+	return e.addResponse(resp)
+}
+
+// Respond with a handler
+func (e *Expectation) RespondWith(handler http.HandlerFunc) *Expectation {
+	return e.addResponse(&response{handler: handler})
+}
+
+// Close the connection without responding, the client sees a network error
+func (e *Expectation) Fail() *Expectation {
+	return e.addResponse(&response{fail: true})
+}
+
+// Number of requests that matched the expectation
+func (e *Expectation) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.calls
+}
+
+func (e *Expectation) addResponse(resp *response) *Expectation {
+	if resp.header == nil {
+		resp.header = http.Header{}
+	}
+
+	e.responses = append(e.responses, resp)
+
+	return e
+}
+
+func (e *Expectation) String() string {
+	return string(e.Method) + " " + e.Pattern
+}
+
+func (e *Expectation) satisfied() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.calls >= e.min
+}
+
+// Count a call and return the response for it, false when the expectation is exhausted
+func (e *Expectation) next() (*response, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.max >= 0 && e.calls >= e.max {
+		return nil, false
+	}
+
+	e.calls++
+
+	if len(e.responses) == 0 {
+		return &response{status: http.StatusOK, header: http.Header{}}, true
+	}
+
+	resp := e.responses[min(e.index, len(e.responses)-1)]
+	e.index++
+
+	return resp, true
+}
+
+// Compare the request with the expectation and describe every difference
+func (e *Expectation) diff(call *Call) []string {
+	diffs := []string{}
+
+	if !strings.EqualFold(string(e.Method), call.Method) {
+		diffs = append(diffs, fmt.Sprintf("method: expected %s, got %s", e.Method, call.Method))
+	}
+
+	if _, ok := matchPattern(e.Pattern, call.Path); !ok {
+		diffs = append(diffs, fmt.Sprintf("path: expected %s, got %s", e.Pattern, call.Path))
+	}
+
+	for _, key := range sortedKeys(e.header) {
+		for _, value := range e.header[key] {
+			if !slices.Contains(call.Header.Values(key), value) {
+				diffs = append(diffs, fmt.Sprintf("header %s: expected %q, got %q", key, value, call.Header.Values(key)))
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(e.query) {
+		for _, value := range e.query[key] {
+			if !slices.Contains(call.Query[key], value) {
+				diffs = append(diffs, fmt.Sprintf("query %s: expected %q, got %q", key, value, call.Query[key]))
+			}
+		}
+	}
+
+	if e.body != nil && !bytes.Equal(*e.body, call.Body) {
+		diffs = append(diffs, fmt.Sprintf("body: expected %q, got %q", *e.body, call.Body))
+	}
+
+	if e.jsonBody != nil && !jsonEqual(e.jsonBody, call.Body) {
+		expected, _ := json.Marshal(e.jsonBody)
+		diffs = append(diffs, fmt.Sprintf("json body: expected %s, got %s", expected, call.Body))
+	}
+
+	return diffs
+}
+
+func jsonEqual(expected any, body []byte) bool {
+	expectedJson, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+
+	var want, got any
+	if json.Unmarshal(expectedJson, &want) != nil || json.Unmarshal(body, &got) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(want, got)
+}
+
+// Match an escaped path against a pattern where {name} matches a single segment
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(patternParts) != len(pathParts) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+
+	for i, part := range patternParts {
+		segment, err := url.PathUnescape(pathParts[i])
+		if err != nil {
+			return nil, false
+		}
+
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") && segment != "" {
+			params[part[1:len(part)-1]] = segment
+			continue
+		}
+
+		if part != segment {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
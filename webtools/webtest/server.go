@@ -0,0 +1,291 @@
+// Package webtest provides a scriptable fake http server for testing clients built on webtools.RestRequest
+package webtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/webtools"
+)
+
+// Server is a fake http server for client tests. Requests are matched against the expectations
+// in the order they were declared, a request that matches none fails the test with the differences
+// to the closest expectation. Unmet expectations are reported when the test ends
+type Server struct {
+	*httptest.Server
+
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []*Call
+	ordered      bool
+}
+
+// Call is a request received by the server
+type Call struct {
+	Method     string
+	Path       string
+	Query      url.Values
+	Header     http.Header
+	Body       []byte
+	PathParams map[string]string
+
+	// The expectation the request matched, nil for unexpected requests
+	Expectation *Expectation
+}
+
+// Start a server that is closed and checked when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	t.Cleanup(func() {
+		s.Close()
+		s.AssertExpectations()
+	})
+
+	return s
+}
+
+// Expect a request for the method and path pattern, {name} in the pattern matches a single path segment
+func (s *Server) Expect(method webtools.RequestMethod, pattern string) *Expectation {
+	e := &Expectation{
+		Method:         method,
+		Pattern:        pattern,
+		header:         http.Header{},
+		query:          map[string][]string{},
+		responseHeader: http.Header{},
+		min:            1,
+		max:            1,
+	}
+
+	s.mu.Lock()
+	s.expectations = append(s.expectations, e)
+	s.mu.Unlock()
+
+	return e
+}
+
+// Require the expectations to be met in the order they were declared
+func (s *Server) InOrder() *Server {
+	s.ordered = true
+	return s
+}
+
+// All requests received so far in the order they arrived
+func (s *Server) Calls() []*Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := make([]*Call, len(s.calls))
+	copy(calls, s.calls)
+
+	return calls
+}
+
+// Report expectations that were not called as often as expected, returns true when all were met
+func (s *Server) AssertExpectations() bool {
+	s.t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok := true
+
+	for _, e := range s.expectations {
+		if !e.satisfied() {
+			s.t.Errorf("webtest: expected %s %s, got %d calls", e, times(e.min), e.Calls())
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// Report an error unless the first calls of the expectations happened in the given order
+func (s *Server) AssertOrder(expectations ...*Expectation) bool {
+	s.t.Helper()
+
+	calls := s.Calls()
+	position := 0
+
+	for _, e := range expectations {
+		found := false
+
+		for ; position < len(calls); position++ {
+			if calls[position].Expectation == e {
+				found = true
+				position++
+				break
+			}
+		}
+
+		if !found {
+			s.t.Errorf("webtest: expected %s to be called after the previous expectations, calls were:\n%s", e, describeCalls(calls))
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	call := &Call{
+		Method: r.Method,
+		Path:   r.URL.EscapedPath(),
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+
+	var exhausted *Expectation
+	var resp *response
+	var index int
+
+	for i, e := range s.expectations {
+		if len(e.diff(call)) > 0 {
+			continue
+		}
+
+		next, ok := e.next()
+		if !ok {
+			exhausted = e
+			continue
+		}
+
+		call.Expectation, resp, index = e, next, i
+		call.PathParams, _ = matchPattern(e.Pattern, call.Path)
+		break
+	}
+
+	var problem string
+
+	switch {
+	case call.Expectation == nil && exhausted != nil:
+		problem = fmt.Sprintf("webtest: unexpected request %s, %s was expected %s", describeCall(call), exhausted, times(exhausted.max))
+	case call.Expectation == nil:
+		problem = s.unexpected(call)
+	case s.ordered:
+		for _, e := range s.expectations[:index] {
+			if !e.satisfied() {
+				problem = fmt.Sprintf("webtest: request %s arrived before expected %s", describeCall(call), e)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if problem != "" {
+		s.t.Error(problem)
+	}
+
+	if call.Expectation == nil {
+		http.Error(w, problem, http.StatusNotImplemented)
+		return
+	}
+
+	if delay := call.Expectation.delay; delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	resp.write(w, r, call.Expectation.responseHeader, body)
+}
+
+// Describe how an unexpected request differs from the expectation with the fewest differences
+func (s *Server) unexpected(call *Call) string {
+	msg := "webtest: unexpected request " + describeCall(call)
+
+	if len(s.expectations) == 0 {
+		return msg + ", no requests were expected"
+	}
+
+	var closest *Expectation
+	var closestDiff []string
+	closestRoute := false
+
+	// Prefer expectations for the same method and path
+	for _, e := range s.expectations {
+		_, pathMatches := matchPattern(e.Pattern, call.Path)
+		route := pathMatches && strings.EqualFold(string(e.Method), call.Method)
+		diff := e.diff(call)
+
+		if closest == nil || (route && !closestRoute) || (route == closestRoute && len(diff) < len(closestDiff)) {
+			closest, closestDiff, closestRoute = e, diff, route
+		}
+	}
+
+	return msg + "\nclosest expectation " + closest.String() + ":\n    " + strings.Join(closestDiff, "\n    ")
+}
+
+func (resp *response) write(w http.ResponseWriter, r *http.Request, header http.Header, body []byte) {
+	if resp.fail {
+		panic(http.ErrAbortHandler)
+	}
+
+	for k, values := range header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+
+	if resp.handler != nil {
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		resp.handler(w, r)
+		return
+	}
+
+	for k, values := range resp.header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+func describeCall(call *Call) string {
+	desc := call.Method + " " + call.Path
+	if len(call.Query) > 0 {
+		desc += "?" + call.Query.Encode()
+	}
+
+	return desc
+}
+
+func describeCalls(calls []*Call) string {
+	if len(calls) == 0 {
+		return "    none"
+	}
+
+	lines := make([]string, len(calls))
+	for i, call := range calls {
+		lines[i] = "    " + describeCall(call)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func times(n int) string {
+	if n == 1 {
+		return "1 time"
+	}
+
+	return fmt.Sprintf("%d times", n)
+}
@@ -0,0 +1,197 @@
+package webtest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scheiblingco/gofn/errtools"
+	"github.com/scheiblingco/gofn/webtools"
+	"github.com/scheiblingco/gofn/webtools/webtest"
+)
+
+// Collects the errors reported by the server instead of failing the test
+type recorder struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.Error(fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) reported() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.errors, "\n")
+}
+
+type user struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestServerExpectations(t *testing.T) {
+	srv := webtest.NewServer(t).InOrder()
+
+	create := srv.Expect(webtools.POST, "/users").
+		WithHeader("Content-Type", "application/json").
+		WithJSONBody(map[string]string{"name": "alice"}).
+		RespondJSON(http.StatusCreated, user{Id: "42", Name: "alice"})
+
+	get := srv.Expect(webtools.GET, "/users/{id}").
+		WithHeader("X-Api-Key", "secret").
+		WithQuery("fields", "name").
+		WithResponseHeader("X-Request-Id", "abc").
+		RespondJSON(http.StatusOK, user{Id: "42", Name: "alice"}).
+		Times(2)
+
+	client := webtools.NewRestClient(srv.URL).WithHeader("X-Api-Key", "secret")
+
+	created, err := webtools.Do[user](client.Post("/users").WithJsonBody(`{ "name" : "alice" }`, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Id != "42" {
+		t.Errorf("Unexpected user %v", created)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get("/users/{id}").WithPathParam("id", "42").WithQueryParams(map[string]string{"fields": "name"}).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+
+		if resp.Response.Header.Get("X-Request-Id") != "abc" {
+			t.Errorf("Expected response header, got %v", resp.Headers)
+		}
+	}
+
+	if create.Calls() != 1 || get.Calls() != 2 {
+		t.Errorf("Unexpected call counts %d and %d", create.Calls(), get.Calls())
+	}
+
+	calls := srv.Calls()
+	if len(calls) != 3 || calls[1].PathParams["id"] != "42" || calls[1].Expectation != get {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	srv.AssertOrder(create, get)
+}
+
+func TestServerResponseSequence(t *testing.T) {
+	srv := webtest.NewServer(t)
+
+	srv.Expect(webtools.GET, "/flaky").
+		Fail().
+		Respond(http.StatusServiceUnavailable, "busy").
+		Respond(http.StatusOK, "ok").
+		Times(3)
+
+	retry := &webtools.RetryPolicy{MaxAttempts: 3, RetryStatusCodes: []int{http.StatusServiceUnavailable}, RetryNetworkErrors: true}
+
+	body, err := webtools.Do[string](webtools.NewRestClient(srv.URL).Get("/flaky").WithRetry(retry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != "ok" {
+		t.Errorf("Expected the third response, got %q", body)
+	}
+}
+
+func TestServerDelay(t *testing.T) {
+	srv := webtest.NewServer(t)
+	srv.Expect(webtools.GET, "/slow").Delay(time.Second).Respond(http.StatusOK, "")
+
+	_, err := webtools.NewRestClient(srv.URL).Get("/slow").WithTimeout(50 * time.Millisecond).Execute()
+
+	if !errors.As(err, &errtools.RequestTimeoutError{}) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+func TestServerReportsProblems(t *testing.T) {
+	rec := &recorder{TB: t}
+	srv := webtest.NewServer(rec).InOrder()
+
+	first := srv.Expect(webtools.GET, "/first")
+	srv.Expect(webtools.POST, "/users/{id}").WithHeader("X-Api-Key", "secret").WithBody("name=alice")
+	never := srv.Expect(webtools.GET, "/never")
+
+	client := webtools.NewRestClient(srv.URL)
+
+	resp, err := client.Post("/users/7").WithBodyString("name=bob").Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 for an unexpected request, got %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err = client.Get("/first").Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	srv.AssertExpectations()
+	srv.AssertOrder(first, never)
+
+	reported := rec.reported()
+
+	for _, expected := range []string{
+		"unexpected request POST /users/7\nclosest expectation POST /users/{id}:",
+		`header X-Api-Key: expected "secret", got []`,
+		`body: expected "name=alice", got "name=bob"`,
+		"unexpected request GET /first, GET /first was expected 1 time",
+		"expected POST /users/{id} 1 time, got 0 calls",
+		"expected GET /never 1 time, got 0 calls",
+		"expected GET /never to be called after the previous expectations",
+	} {
+		if !strings.Contains(reported, expected) {
+			t.Errorf("Expected %q to be reported, got:\n%s", expected, reported)
+		}
+	}
+}
+
+func TestServerOrder(t *testing.T) {
+	rec := &recorder{TB: t}
+	srv := webtest.NewServer(rec).InOrder()
+
+	srv.Expect(webtools.POST, "/login")
+	srv.Expect(webtools.GET, "/data")
+
+	client := webtools.NewRestClient(srv.URL)
+
+	for _, req := range []*webtools.RestRequest{client.Get("/data"), client.Post("/login")} {
+		resp, err := req.Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	if reported := rec.reported(); !strings.Contains(reported, "request GET /data arrived before expected POST /login") {
+		t.Errorf("Expected the order to be reported, got:\n%s", reported)
+	}
+}